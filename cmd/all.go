@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/sstarcher/helm-release/helm"
+	"github.com/sstarcher/helm-release/release"
+)
+
+var concurrency int
+
+// chartRun is the release of one chart of a run over all charts
+type chartRun struct {
+	chart *helm.Chart
+	plan  *release.Plan
+	err   error
+	// out and report buffer the stdout and the strict mode report of the
+	// chart so they are printed in release order
+	out    bytes.Buffer
+	report bytes.Buffer
+	// done is closed once the chart is staged or failed
+	done chan struct{}
+	// staged is closed once the chart and every chart before it is staged
+	staged chan struct{}
+}
+
+// chartError is the failure of a chart of the run
+type chartError struct {
+	chart string
+	err   error
+}
+
+// chartErrors are the failures of the charts of a run in release order
+type chartErrors []chartError
+
+func (e chartErrors) Error() string {
+	messages := []string{}
+	for _, item := range e {
+		messages = append(messages, fmt.Sprintf("failed to release %s %s", item.chart, item.err))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Is matches the failure of any chart so the exit code reflects it
+func (e chartErrors) Is(target error) bool {
+	for _, item := range e {
+		if errors.Is(item.err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseAll releases every chart under dir. Up to concurrency charts compute
+// their version at the same time once their dependencies are staged, while
+// the files are staged one chart at a time in release order so the result
+// does not depend on the scheduling. Nothing is written when a chart fails.
+func releaseAll(ctx context.Context, cmd *cobra.Command, dir string) error {
+	if concurrency < 1 {
+		return fmt.Errorf("invalid input for concurrency %d", concurrency)
+	}
+
+	files = helm.NewFileSet()
+	takeSnapshot(ctx, dir)
+
+	graph, order, bumps, err := orderCharts(dir)
+	if err != nil {
+		return err
+	}
+
+	runs := make([]*chartRun, len(order))
+	byChart := map[*helm.Chart]*chartRun{}
+	for i, chart := range order {
+		runs[i] = &chartRun{chart: chart, done: make(chan struct{}), staged: make(chan struct{})}
+		byChart[chart] = runs[i]
+	}
+
+	// umbrella charts of the run are bumped by their own release
+	released := []string{}
+	for _, chart := range order {
+		released = append(released, chart.Path())
+	}
+
+	slots := make(chan struct{}, concurrency)
+	previous := make(chan struct{})
+	close(previous)
+
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		deps := []*chartRun{}
+		for _, dep := range graph.Dependencies(run.chart) {
+			deps = append(deps, byChart[dep])
+		}
+
+		wg.Add(1)
+		go func(run *chartRun, previous chan struct{}, deps []*chartRun) {
+			defer wg.Done()
+			defer func() {
+				<-previous
+				close(run.staged)
+			}()
+			defer close(run.done)
+
+			run.err = run.release(ctx, cmd, previous, deps, slots, bumps[run.chart], released)
+		}(run, previous, deps)
+		previous = run.staged
+	}
+	wg.Wait()
+
+	failed := chartErrors{}
+	for _, run := range runs {
+		_, err = os.Stderr.Write(run.report.Bytes())
+		if err == nil {
+			_, err = cmd.OutOrStdout().Write(run.out.Bytes())
+		}
+		if err != nil {
+			return err
+		}
+		if run.err != nil {
+			failed = append(failed, chartError{run.chart.Path(), run.err})
+		}
+	}
+	if len(failed) > 0 {
+		return failed
+	}
+	if printComputedVersion {
+		return nil
+	}
+
+	err = checkTags(runs)
+	if err != nil {
+		return err
+	}
+
+	// the first plan writes the files of every chart
+	for _, run := range runs {
+		err = applyPlan(ctx, run.plan)
+		if err != nil {
+			return fmt.Errorf("failed to release %s %w", run.chart.Path(), err)
+		}
+	}
+	return printDiff(cmd)
+}
+
+// checkTags rejects tags that exist or that several charts would create
+// before any file is written, the tags are only created after the files
+func checkTags(runs []*chartRun) error {
+	existing := map[string]bool{}
+	if snapshot != nil {
+		for _, tag := range snapshot.Tags {
+			existing[tag.Name] = true
+		}
+	}
+	tagged := map[string]string{}
+	for _, run := range runs {
+		switch other, ok := tagged[run.plan.Tag]; {
+		case run.plan.Tag == "":
+			continue
+		case existing[run.plan.Tag]:
+			return fmt.Errorf("the tag %s of %s already exists", run.plan.Tag, run.chart.Path())
+		case ok:
+			return fmt.Errorf("%s and %s would both be tagged %s, add {chart} to the tag prefix", other, run.chart.Path(), run.plan.Tag)
+		}
+		tagged[run.plan.Tag] = run.chart.Path()
+	}
+	return nil
+}
+
+// release computes the version of the chart once its dependencies are staged
+// and stages its files after the chart before it
+func (r *chartRun) release(ctx context.Context, cmd *cobra.Command, previous <-chan struct{}, deps []*chartRun, slots chan struct{}, bumped []string, released []string) error {
+	for _, dep := range deps {
+		<-dep.done
+		if dep.err != nil {
+			return fmt.Errorf("skipped because its dependency %s failed", dep.chart.Path())
+		}
+	}
+
+	logger := log.WithField("chart", r.chart.Path())
+	if len(bumped) > 0 {
+		logger.Infof("releasing the chart, it needs a bump because the dependencies %s changed", strings.Join(bumped, ", "))
+	} else {
+		logger.Info("releasing the chart")
+	}
+
+	slots <- struct{}{}
+	ver, err := nextVersion(ctx, cmd, r.chart.Path(), &r.report)
+	<-slots
+	if err != nil {
+		return err
+	}
+
+	if printComputedVersion {
+		_, err = fmt.Fprintf(&r.out, "%s %s\n", r.chart.Path(), ver.String())
+		return err
+	}
+
+	<-previous
+	options := releaseOptions(cmd)
+	options.Helm.Released = released
+	r.plan, err = release.Stage(ctx, r.chart.Path(), ver, options)
+	if err != nil {
+		return err
+	}
+	logPropagated(r.plan)
+	return nil
+}
+
+func init() {
+	rootCmd.Flags().IntVar(&concurrency, "concurrency", 1, "Number of charts whose version is computed at the same time with --all")
+}
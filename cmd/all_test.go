@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/sstarcher/helm-release/helm"
+	"github.com/stretchr/testify/assert"
+)
+
+// releaseCharts are charts where broken has no image tag in its values and
+// umbrella depends on it
+var releaseCharts = map[string]string{
+	"a/Chart.yaml":        "apiVersion: v2\nname: a\nversion: 0.1.0\n",
+	"a/values.yaml":       "image:\n  tag: 0.1.0\n",
+	"b/Chart.yaml":        "apiVersion: v2\nname: b\nversion: 0.1.0\ndependencies:\n- name: a\n  version: 0.1.0\n  repository: file://../a\n",
+	"b/values.yaml":       "image:\n  tag: 0.1.0\n",
+	"broken/Chart.yaml":   "apiVersion: v2\nname: broken\nversion: 0.1.0\n",
+	"broken/values.yaml":  "replicas: 1\n",
+	"c/Chart.yaml":        "apiVersion: v2\nname: c\nversion: 0.1.0\n",
+	"c/values.yaml":       "image:\n  tag: 0.1.0\n",
+	"umbrella/Chart.yaml": "apiVersion: v2\nname: umbrella\nversion: 0.1.0\ndependencies:\n- name: broken\n  version: 0.1.0\n  repository: file://../broken\n",
+}
+
+// newChartRepo commits the charts to a new git repository tagged 1.0.0
+func newChartRepo(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "helm-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range releaseCharts {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.name", "test"},
+		{"config", "user.email", "test@example.com"},
+		{"checkout", "-q", "-b", "master"},
+		{"add", "-A"},
+		{"commit", "-q", "-m", "charts"},
+		{"tag", "-a", "1.0.0", "-m", "1.0.0"},
+		{"commit", "-q", "--allow-empty", "-m", "next"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %s %s", args, err, out)
+		}
+	}
+	return dir
+}
+
+// releaseAllWith runs releaseAll over dir with the flags set for the run and
+// returns its stdout
+func releaseAllWith(dir string, workers int, print bool, strictPaths bool) (string, error) {
+	concurrency, printComputedVersion, strictPath = workers, print, strictPaths
+	defer func() {
+		concurrency, printComputedVersion, strictPath = 1, false, false
+	}()
+
+	var out bytes.Buffer
+	cmd := &cobra.Command{}
+	cmd.SetOutput(&out)
+	err := releaseAll(context.Background(), cmd, dir)
+	return out.String(), err
+}
+
+func TestReleaseAllOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newChartRepo(t)
+	defer os.RemoveAll(dir)
+
+	expected, err := releaseAllWith(dir, 1, true, false)
+	assert.Nil(err)
+	lines := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(expected), "\n") {
+		lines = append(lines, filepath.Base(strings.Fields(line)[0]))
+	}
+	assert.Equal([]string{"a", "b", "broken", "c", "umbrella"}, lines)
+
+	for _, workers := range []int{2, 4, 16} {
+		out, err := releaseAllWith(dir, workers, true, false)
+		assert.Nil(err)
+		assert.Equal(expected, out)
+	}
+
+	_, err = releaseAllWith(dir, 0, true, false)
+	assert.NotNil(err)
+}
+
+func TestReleaseAllFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newChartRepo(t)
+	defer os.RemoveAll(dir)
+
+	_, err := releaseAllWith(dir, 4, false, true)
+	assert.True(errors.Is(err, helm.ErrPathMissing))
+
+	var failed chartErrors
+	if assert.True(errors.As(err, &failed)) && assert.Len(failed, 2) {
+		assert.Equal(filepath.Join(dir, "broken"), failed[0].chart)
+		assert.True(errors.Is(failed[0].err, helm.ErrPathMissing))
+		assert.Equal(filepath.Join(dir, "umbrella"), failed[1].chart)
+		assert.Contains(failed[1].err.Error(), "skipped because its dependency")
+	}
+
+	// the charts released before the failure are not written either
+	for name, content := range releaseCharts {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(err)
+		assert.Equal(content, string(data), name)
+	}
+
+	_, err = releaseAllWith(dir, 4, false, false)
+	assert.Nil(err)
+	data, err := ioutil.ReadFile(filepath.Join(dir, "a", "values.yaml"))
+	assert.Nil(err)
+	assert.Contains(string(data), "tag: 1.0.1-1")
+}
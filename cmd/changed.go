@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/sstarcher/helm-release/git"
+	"github.com/sstarcher/helm-release/helm"
+)
+
+var (
+	baseRef       string
+	mainline      string
+	changedFormat string
+)
+
+// ChangedChart is a chart affected by the changes since the base ref
+type ChangedChart struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Changed is set when files within the chart directory changed
+	Changed bool `json:"changed"`
+	// Dependencies lists the affected local dependencies of the chart
+	Dependencies []string `json:"dependencies"`
+}
+
+// changedCmd lists the charts affected by the changes since a base ref
+var changedCmd = &cobra.Command{
+	Use:   "changed [DIR]",
+	Short: "Lists the charts whose files or local dependencies changed since the base ref",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := chartDir(args, 0)
+
+		ctx, cancel := runContext()
+		defer cancel()
+		charts, err := changedCharts(ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		switch changedFormat {
+		case "json":
+			out, err := json.MarshalIndent(charts, "", "  ")
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			return err
+		case "text":
+			for _, chart := range charts {
+				line := chart.Path
+				if !chart.Changed {
+					line += fmt.Sprintf(" (dependencies %s)", strings.Join(chart.Dependencies, ", "))
+				}
+				_, err = fmt.Fprintln(cmd.OutOrStdout(), line)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		default:
+			return fmt.Errorf("invalid input for output %s", changedFormat)
+		}
+	},
+}
+
+// diffBase returns the base ref or the merge base of HEAD and the mainline
+func diffBase(ctx context.Context, repo *git.Git) (string, error) {
+	if baseRef != "" {
+		return baseRef, nil
+	}
+	return repo.MergeBase(ctx, mainline)
+}
+
+// changedFiles lists the files of the repository containing dir that
+// changed since the base ref
+func changedFiles(ctx context.Context, dir string) (*git.Git, string, []string, error) {
+	repo, err := git.New(ctx, dir, nil)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	base, err := diffBase(ctx, repo)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	files, err := repo.ChangedFiles(ctx, base)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return repo, base, files, nil
+}
+
+// changedCharts finds in release order the charts under dir affected by the
+// changes since the base ref
+func changedCharts(ctx context.Context, dir string) ([]ChangedChart, error) {
+	_, _, files, err := changedFiles(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	charts, err := helm.FindCharts(dir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := []*helm.Chart{}
+	own := map[*helm.Chart]bool{}
+	for _, file := range files {
+		if chart := helm.Owner(charts, file); chart != nil && !own[chart] {
+			own[chart] = true
+			changed = append(changed, chart)
+		}
+	}
+
+	graph, err := helm.NewGraph(charts)
+	if err != nil {
+		return nil, err
+	}
+	affected, err := graph.Affected(changed)
+	if err != nil {
+		return nil, err
+	}
+
+	isAffected := map[*helm.Chart]bool{}
+	result := []ChangedChart{}
+	for _, chart := range affected {
+		isAffected[chart] = true
+
+		deps := []string{}
+		for _, dep := range graph.Dependencies(chart) {
+			if isAffected[dep] {
+				deps = append(deps, dep.Name)
+			}
+		}
+		result = append(result, ChangedChart{
+			Name:         chart.Name,
+			Path:         chart.Path(),
+			Changed:      own[chart],
+			Dependencies: deps,
+		})
+	}
+	return result, nil
+}
+
+func init() {
+	changedCmd.Flags().StringVar(&baseRef, "base", "", "Ref the changes are compared against, defaults to the merge base of HEAD and the mainline")
+	changedCmd.Flags().StringVar(&mainline, "mainline", git.DefaultMainline, "Branch whose merge base with HEAD is the default base ref")
+	changedCmd.Flags().StringVar(&changedFormat, "output", "text", "Format of the changed charts (text, json)")
+	rootCmd.AddCommand(changedCmd)
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// pluginConfigFile is the per-plugin config read from HELM_PLUGIN_DIR
+const pluginConfigFile = "config.yaml"
+
+// helmEnv are the variables Helm passes to plugins
+var helmEnv = []string{
+	"HELM_BIN",
+	"HELM_DEBUG",
+	"HELM_KUBECONTEXT",
+	"HELM_NAMESPACE",
+	"HELM_PLUGIN_DIR",
+	"HELM_PLUGIN_NAME",
+	"HELM_PLUGINS",
+}
+
+var debug bool
+
+// envCmd prints the Helm plugin environment and the effective configuration
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Prints the Helm plugin environment and the effective configuration",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := applyConfig(rootCmd.Flags())
+		if err != nil {
+			return err
+		}
+
+		lines := []string{}
+		for _, name := range helmEnv {
+			lines = append(lines, fmt.Sprintf("%s=%q", name, os.Getenv(name)))
+		}
+		lines = append(lines, fmt.Sprintf("config=%q", viper.ConfigFileUsed()))
+		lines = append(lines, fmt.Sprintf("log-level=%q", log.GetLevel().String()))
+
+		// flags are visited sorted by name, config and log-level are printed
+		// above with their resolved values
+		rootCmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if f.Name == "config" || f.Name == "log-level" {
+				return
+			}
+			lines = append(lines, fmt.Sprintf("%s=%q", f.Name, f.Value.String()))
+		})
+
+		for _, line := range lines {
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), line)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// helmDebug reports whether Helm runs with --debug
+func helmDebug() bool {
+	enabled, err := strconv.ParseBool(os.Getenv("HELM_DEBUG"))
+	return err == nil && enabled
+}
+
+// pluginConfig returns the config file in the plugin directory when it exists
+func pluginConfig() string {
+	dir := os.Getenv("HELM_PLUGIN_DIR")
+	if dir == "" {
+		return ""
+	}
+
+	file := filepath.Join(dir, pluginConfigFile)
+	if _, err := os.Stat(file); err != nil {
+		return ""
+	}
+	return file
+}
+
+// applyConfig sets the flags not given on the command line from the config
+// file, keys are the flag names and lists are used for repeated flags
+func applyConfig(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(f *pflag.Flag) {
+		if err != nil || f.Changed || !viper.IsSet(f.Name) {
+			return
+		}
+
+		values := []string{viper.GetString(f.Name)}
+		if f.Value.Type() == "stringArray" || f.Value.Type() == "stringSlice" {
+			values = viper.GetStringSlice(f.Name)
+		}
+		for _, value := range values {
+			if setErr := f.Value.Set(value); setErr != nil {
+				err = fmt.Errorf("invalid config value %s for %s %s", value, f.Name, setErr)
+				return
+			}
+		}
+	})
+	return err
+}
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&debug, "debug", false, "Enables debug logging, also enabled by HELM_DEBUG")
+	rootCmd.AddCommand(envCmd)
+}
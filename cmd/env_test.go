@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvKeysOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	var out bytes.Buffer
+	envCmd.SetOutput(&out)
+	defer envCmd.SetOutput(nil)
+	assert.Nil(envCmd.RunE(envCmd, nil))
+
+	keys := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		keys[strings.SplitN(line, "=", 2)[0]]++
+	}
+	assert.Equal(1, keys["config"])
+	assert.Equal(1, keys["log-level"])
+	for key, count := range keys {
+		assert.Equal(1, count, key)
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sstarcher/helm-release/git"
+	"github.com/sstarcher/helm-release/helm"
+)
+
+// exit codes of the failure categories
+const (
+	exitError          = 1
+	exitChanges        = 2
+	exitNoTags         = 3
+	exitLightweightTag = 4
+	exitTagsOutOfSync  = 5
+	exitChartNotFound  = 6
+	exitPathMissing    = 7
+	exitTimeout        = 8
+)
+
+// exitCodes maps the typed errors to their exit code, the first match wins
+var exitCodes = []struct {
+	err  error
+	code int
+}{
+	{errDryRunChanges, exitChanges},
+	{git.ErrTagsOutOfSync, exitTagsOutOfSync},
+	{git.ErrLightweightTag, exitLightweightTag},
+	{git.ErrNoTags, exitNoTags},
+	{helm.ErrChartNotFound, exitChartNotFound},
+	{helm.ErrPathMissing, exitPathMissing},
+	{context.DeadlineExceeded, exitTimeout},
+}
+
+// exitCode returns the exit code of the error category
+func exitCode(err error) int {
+	for _, item := range exitCodes {
+		if errors.Is(err, item.err) {
+			return item.code
+		}
+	}
+	return exitError
+}
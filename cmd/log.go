@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+var (
+	logLevel  string
+	logFormat string
+)
+
+// configureLogging applies the log flags, logs are written to stderr so
+// stdout only carries the output of the commands
+func configureLogging() error {
+	level := logLevel
+	if debug || helmDebug() {
+		level = log.DebugLevel.String()
+	}
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return fmt.Errorf("invalid input for log-level %s", level)
+	}
+
+	switch logFormat {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	default:
+		return fmt.Errorf("invalid input for log-format %s expected text or json", logFormat)
+	}
+
+	log.SetLevel(parsed)
+	log.SetOutput(os.Stderr)
+
+	if viper.ConfigFileUsed() != "" {
+		log.WithField("config", viper.ConfigFileUsed()).Debug("using the config file")
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", log.InfoLevel.String(), "Minimum level of the logs written to stderr (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Format of the logs written to stderr (text, json)")
+}
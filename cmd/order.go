@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/sstarcher/helm-release/helm"
+)
+
+// orderCmd prints the charts in the order they have to be released
+var orderCmd = &cobra.Command{
+	Use:   "order [DIR]",
+	Short: "Prints the charts with dependencies before the charts depending on them",
+	Long: `Lists every chart under DIR in release order. Charts whose local dependencies
+no longer satisfy their version constraint, or depend on such a chart, are marked as needing a bump.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := chartDir(args, 0)
+
+		_, order, bumps, err := orderCharts(dir)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := runContext()
+		defer cancel()
+		for _, chart := range order {
+			ver, err := chart.Get(ctx)
+			if err != nil {
+				return err
+			}
+
+			line := fmt.Sprintf("%s %s", chart.Path(), ver.String())
+			if deps, ok := bumps[chart]; ok {
+				line += fmt.Sprintf(" needs bump (%s)", strings.Join(deps, ", "))
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), line)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+// orderCharts finds the dependency graph of the charts under dir, the charts
+// in release order and the changed dependencies of the charts needing a bump
+func orderCharts(dir string) (*helm.Graph, []*helm.Chart, map[*helm.Chart][]string, error) {
+	charts, err := helm.FindCharts(dir, nil)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	graph, err := helm.NewGraph(charts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	order, err := graph.Order()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	bumps, err := graph.NeedsBump()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return graph, order, bumps, nil
+}
+
+func init() {
+	rootCmd.AddCommand(orderCmd)
+}
@@ -1,29 +1,71 @@
 package cmd
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/Masterminds/semver"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"github.com/sstarcher/helm-release/git"
 	"github.com/sstarcher/helm-release/helm"
-	"github.com/sstarcher/helm-release/version"
+	"github.com/sstarcher/helm-release/registry"
+	"github.com/sstarcher/helm-release/release"
 )
 
 var (
 	cfgFile              string
 	tag                  string
 	skipTag              bool
-	tagPath              string
+	tagPaths             []string
 	printComputedVersion bool
 	bump                 string
 	source               string
 	strict               bool
+	reportFormat         string
+	tagsMerged           bool
+	tagsBranch           string
+	tagsPattern          string
+	maintenance          []string
+	tagPrefix            string
+	tagPattern           string
+	createTag            bool
+	shallow              string
+	discoverImages       bool
+	imageRepository      string
+	digest               string
+	image                string
+	registryPlainHTTP    bool
+	valuesFiles          []string
+	createPath           bool
+	strictPath           bool
+	appVersionSource     string
+	appVersionPolicy     string
+	propagate            bool
+	propagateRoot        string
+	updateLock           bool
+	all                  bool
+	dryRun               bool
+	// files stages the file changes of a release
+	files *helm.FileSet
+	// snapshot is the git repository state shared by the charts of a run
+	snapshot *git.Snapshot
 )
 
+// appVersionSourceHelp describes the supported appVersion sources
+const appVersionSourceHelp = "Source of the Chart.yaml appVersion (image-tag, git:TAG_PREFIX, file:PATH where a .json file provides its version field)"
+
+// errDryRunChanges is returned when a dry run would change files
+var errDryRunChanges = errors.New("the release would change files")
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "helm-release [CHART_PATH]",
@@ -31,70 +73,237 @@ var rootCmd = &cobra.Command{
 	Long: `This plugin will use environment variables and git history to divine the next chart version.
 	It will also optionally update the image tag in the values.yaml file.`,
 	Args: cobra.MinimumNArgs(1),
-	RunE: func(cmd *cobra.Command, args []string) error {
-		dir := "."
-		if len(args) > 0 {
-			dir = args[0]
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		err := applyConfig(cmd.Flags())
+		if err != nil {
+			return err
 		}
+		return configureLogging()
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := chartDir(args, 0)
 
-		var getter version.Getter
-		if source == "git" {
-			source, err := git.New(dir)
-			if err != nil {
-				return err
-			}
-			getter = source.(version.Getter)
-		} else if source == "helm" {
-			if bump == "" {
-				log.Fatal("--bump must be specified when using a helm source")
-			}
-			source, err := helm.New(dir, nil)
-			if err != nil {
-				return err
-			}
-			getter = source.(version.Getter)
-		} else {
-			log.Fatalf("invalid input for source %s", source)
+		ctx, cancel := runContext()
+		defer cancel()
+
+		if all {
+			return releaseAll(ctx, cmd, dir)
 		}
+		return runRelease(ctx, cmd, dir)
+	},
+}
+
+// runRelease releases the chart in dir and prints the diff of a dry run
+func runRelease(ctx context.Context, cmd *cobra.Command, dir string) error {
+	files = helm.NewFileSet()
+	takeSnapshot(ctx, dir)
+	err := releaseChart(ctx, cmd, dir)
+	if err != nil {
+		return err
+	}
+	return printDiff(cmd)
+}
+
+// nextVersion computes the next version of the chart in dir, in strict mode
+// out of sync tags fail after writing the report to w
+func nextVersion(ctx context.Context, cmd *cobra.Command, dir string, w io.Writer) (*semver.Version, error) {
+	ver, err := release.NextVersion(ctx, dir, releaseOptions(cmd))
+	if reportErr := reportOutOfSync(w, err); reportErr != nil {
+		return nil, reportErr
+	}
+	return ver, err
+}
+
+// reportOutOfSync writes the report of out of sync tags when err has one
+func reportOutOfSync(w io.Writer, err error) error {
+	var syncErr *git.OutOfSyncError
+	if errors.As(err, &syncErr) {
+		return writeReport(w, syncErr.Report)
+	}
+	return nil
+}
 
-		nextType := version.NewNextType(bump)
-		version, err := getter.NextVersion(nextType)
-		if version == nil {
+// releaseChart computes the next version of the chart in dir and updates it
+func releaseChart(ctx context.Context, cmd *cobra.Command, dir string) error {
+	if printComputedVersion {
+		version, err := nextVersion(ctx, cmd, dir, os.Stderr)
+		if err != nil {
 			return err
 		}
+		_, err = os.Stdout.WriteString(version.String())
+		return err
+	}
 
-		if err != nil && strict {
-			return err
+	plan, err := release.Compute(ctx, dir, releaseOptions(cmd))
+	if reportErr := reportOutOfSync(os.Stderr, err); reportErr != nil {
+		return reportErr
+	}
+	if err != nil {
+		return err
+	}
+
+	logPropagated(plan)
+	return applyPlan(ctx, plan)
+}
+
+// logPropagated logs the umbrella charts updated by the plan
+func logPropagated(plan *release.Plan) {
+	logger := log.WithFields(log.Fields{"chart": plan.Chart, "version": plan.Version.String()})
+	for _, result := range plan.Propagated {
+		if result.Version == "" {
+			logger.WithField("umbrella", result.Chart).Infof("updated the %s dependency, the umbrella chart is released on its own", result.Dependency)
+			continue
 		}
+		logger.WithField("umbrella", result.Chart).Infof("updated the %s dependency and bumped the umbrella chart to %s", result.Dependency, result.Version)
+	}
+}
 
-		if printComputedVersion {
-			_, err = os.Stdout.WriteString(version.String())
-			return err
+// applyPlan writes the plan and creates its tag unless this is a dry run
+func applyPlan(ctx context.Context, plan *release.Plan) error {
+	logger := log.WithFields(log.Fields{"chart": plan.Chart, "version": plan.Version.String()})
+	if dryRun {
+		if createTag {
+			logger.Info("skipping the git tag in a dry run")
 		}
+		return nil
+	}
 
-		log.Infof("updating the Chart.yaml to version %s", version.String())
-		chart, err := helm.New(dir, &tagPath)
+	err := plan.Apply(ctx)
+	if err != nil {
+		return err
+	}
+	if plan.Tag != "" {
+		logger.WithField("tag", plan.Tag).Info("created the git tag")
+	}
+	return nil
+}
+
+// releaseOptions builds the release options from the flags
+func releaseOptions(cmd *cobra.Command) *release.Options {
+	return &release.Options{
+		Source:           source,
+		Bump:             bump,
+		Strict:           strict,
+		Git:              *gitOptions(),
+		Helm:             *helmOptions(cmd),
+		ImageTag:         tag,
+		SkipImageTag:     skipTag,
+		AppVersionSource: appVersionSource,
+		Propagate:        propagate,
+		PropagateRoot:    propagateRoot,
+		UpdateLock:       updateLock,
+		CreateTag:        createTag,
+	}
+}
+
+// helmOptions builds the chart options from the flags
+func helmOptions(cmd *cobra.Command) *helm.Options {
+	client := registry.New()
+	client.PlainHTTP = registryPlainHTTP
+	client.Username = os.Getenv("REGISTRY_USERNAME")
+	client.Password = os.Getenv("REGISTRY_PASSWORD")
+
+	options := &helm.Options{
+		AppVersionPolicy: appVersionPolicy,
+		ValuesFiles:      valuesFiles,
+		TagPaths:         tagPaths,
+		CreatePath:       createPath,
+		StrictPath:       strictPath,
+		DiscoverImages:   discoverImages,
+		ImageRepository:  imageRepository,
+		Digest:           digest,
+		Image:            image,
+		Resolver:         client,
+		Files:            files,
+	}
+	if discoverImages && !cmd.Flags().Changed("path") {
+		options.TagPaths = nil
+	}
+	return options
+}
+
+// printDiff prints the unified diff of every file a dry run would change and
+// returns errDryRunChanges when there are any
+func printDiff(cmd *cobra.Command) error {
+	if !dryRun {
+		return nil
+	}
+
+	edits := files.Edits()
+	for _, edit := range edits {
+		diff, err := edit.Diff()
 		if err != nil {
 			return err
 		}
-
-		if !skipTag && tag == "" {
-			ver, _ := version.SetMetadata("")
-			tag = ver.String()
+		_, err = fmt.Fprint(cmd.OutOrStdout(), diff)
+		if err != nil {
+			return err
 		}
-		chart.UpdateChart(version, tag)
+	}
 
-		return nil
-	},
+	if len(edits) > 0 {
+		// the exit code reports the changes, there is nothing to print
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return errDryRunChanges
+	}
+	return nil
+}
+
+// gitOptions builds the git source options from the flags
+func gitOptions() *git.Options {
+	return &git.Options{
+		Merged:      tagsMerged,
+		Branch:      tagsBranch,
+		Pattern:     tagsPattern,
+		Maintenance: maintenance,
+		TagPrefix:   tagPrefix,
+		TagPattern:  tagPattern,
+		Shallow:     shallow,
+		Env:         os.LookupEnv,
+		Snapshot:    snapshot,
+	}
+}
+
+// takeSnapshot collects the state of the git repository containing dir once
+// for the run, without a repository every git source collects its own
+func takeSnapshot(ctx context.Context, dir string) {
+	var err error
+	snapshot, err = git.NewSnapshot(ctx, dir)
+	if err != nil {
+		log.WithField("directory", dir).Debugf("unable to take a snapshot of the git repository %s", err)
+	}
+}
+
+// writeReport prints the strict mode report to w in the requested format
+func writeReport(w io.Writer, report *git.SyncReport) error {
+	switch reportFormat {
+	case "json":
+		out, err := report.JSON()
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	case "text":
+		_, err := fmt.Fprint(w, report.String())
+		return err
+	default:
+		return fmt.Errorf("invalid input for report-format %s", reportFormat)
+	}
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
-	if err := rootCmd.Execute(); err != nil {
-		log.Info(err)
-		os.Exit(1)
+	err := rootCmd.Execute()
+	if err == nil {
+		return
+	}
+	if err != errDryRunChanges {
+		log.Error(err)
 	}
+	os.Exit(exitCode(err))
 }
 
 func init() {
@@ -103,17 +312,51 @@ func init() {
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
-	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.helm-release.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HELM_PLUGIN_DIR/config.yaml or $HOME/.helm-release.yaml)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
-	rootCmd.Flags().StringVarP(&tag, "tag", "t", "", "Sets the docker image tag in values.yaml")
-	rootCmd.Flags().BoolVarP(&skipTag, "skip-application-version", "s", false, "Skips setting image.tag and Chart.yaml appVersion")
-	rootCmd.Flags().StringVar(&tagPath, "path", helm.DefaultTagPath, "Sets the path to the image tag to modify in values.yaml")
 	rootCmd.Flags().BoolVar(&printComputedVersion, "print-computed-version", false, "Print the computed version string to stdout")
 	rootCmd.Flags().StringVar(&bump, "bump", "", "Specifies to bump major, minor, or patch when using print-computed-version")
-	rootCmd.Flags().StringVar(&source, "source", "git", "Specifies the source of the version information options (git, helm)")
-	rootCmd.Flags().BoolVar(&strict, "strict", false, "When enabled it will look through all tags for semver tags and fail if tags exist outside of master")
+	rootCmd.Flags().BoolVar(&all, "all", false, "Releases every chart under CHART_PATH with dependencies before the charts depending on them")
+	addSourceFlags(rootCmd.Flags())
+	addUpdateFlags(rootCmd.Flags())
+}
+
+// addSourceFlags adds the flags selecting and configuring the version source
+func addSourceFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&source, "source", "git", "Specifies the source of the version information options (git, helm)")
+	flags.BoolVar(&strict, "strict", false, "When enabled it will look through all tags for semver tags and fail if tags exist outside of master")
+	flags.BoolVar(&tagsMerged, "tags-merged", false, "Only compare against semver tags reachable from HEAD")
+	flags.StringVar(&tagsBranch, "tags-branch", "", "Only compare against semver tags reachable from the branch")
+	flags.StringVar(&tagsPattern, "tags-pattern", "", "Only compare against semver tags matching the glob")
+	flags.StringArrayVar(&maintenance, "maintenance-branch", []string{}, "Regular expression with the named groups major and minor matching branches constrained to a release line")
+	flags.StringVar(&tagPrefix, "tag-prefix", "", "Prefix in front of the version of release tags, for example chart/{chart}/ where {chart} is the chart directory name")
+	flags.StringVar(&tagPattern, "tag-pattern", "", "Regular expression with the named group version matching release tags")
+	flags.StringVar(&shallow, "shallow", git.ShallowFail, "Handling of shallow clones without a release tag (fail, unshallow, deepen)")
+	flags.StringVar(&reportFormat, "report-format", "text", "Format of the strict mode report of out of sync tags (text, json)")
+}
+
+// addUpdateFlags adds the flags controlling how the chart files are updated
+func addUpdateFlags(flags *pflag.FlagSet) {
+	flags.StringVarP(&tag, "tag", "t", "", "Sets the docker image tag in values.yaml")
+	flags.BoolVarP(&skipTag, "skip-application-version", "s", false, "Skips setting image.tag and Chart.yaml appVersion")
+	flags.StringArrayVar(&tagPaths, "path", []string{helm.DefaultTagPath}, "Sets the path to the image tag to modify in values.yaml, may be repeated and * matches any key")
+	flags.StringArrayVar(&valuesFiles, "values-file", []string{helm.DefaultValuesFile}, "Glob relative to the chart of the values files to update, may be repeated")
+	flags.BoolVar(&createPath, "create-path", false, "Creates the missing keys of the image tag path in the values files")
+	flags.BoolVar(&strictPath, "strict-path", false, "Fails instead of warning when the image tag path can not be updated")
+	flags.BoolVar(&discoverImages, "discover-images", false, "Sets the tag of every image map with repository and tag keys in values.yaml")
+	flags.StringVar(&imageRepository, "image-repository", "", "Regular expression limiting the discovered images by repository")
+	flags.StringVar(&digest, "digest", "", "Pins images to their registry manifest digest, digest writes it next to the tag and tag writes tag@sha256:...")
+	flags.StringVar(&image, "image", "", "Image used to resolve digests, defaults to the repository and registry keys next to the tag")
+	flags.BoolVar(&registryPlainHTTP, "registry-plain-http", false, "Resolves digests from the registry over http instead of https")
+	flags.StringVar(&appVersionSource, "app-version-source", "image-tag", appVersionSourceHelp)
+	flags.StringVar(&appVersionPolicy, "app-version-policy", helm.AppVersionUpdate, "Sets the appVersion only when it exists (update), also when missing (create) or never (keep)")
+	flags.BoolVar(&propagate, "propagate", false, "Updates the dependency version in umbrella charts and bumps their patch version")
+	flags.StringVar(&propagateRoot, "propagate-root", ".", "Directory searched for umbrella charts when propagating")
+	flags.BoolVar(&updateLock, "update-lock", false, "Refreshes the Chart.lock or requirements.lock of umbrella charts when propagating")
+	flags.BoolVar(&dryRun, "dry-run", false, "Prints the diff of the files the release would change without writing them, exits with 2 when there are changes")
+	flags.BoolVar(&createTag, "create-tag", false, "Creates an annotated git tag for the computed version after updating the chart")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -121,23 +364,25 @@ func initConfig() {
 	if cfgFile != "" {
 		// Use config file from the flag.
 		viper.SetConfigFile(cfgFile)
+	} else if file := pluginConfig(); file != "" {
+		// Use the config of the Helm plugin.
+		viper.SetConfigFile(file)
 	} else {
 		// Find home directory.
 		home, err := homedir.Dir()
 		if err != nil {
-			log.Info(err)
-			os.Exit(1)
+			log.Warnf("skipping the config in the home directory %s", err)
+		} else {
+			// Search config in home directory with name ".helm-release" (without extension).
+			viper.AddConfigPath(home)
 		}
-
-		// Search config in home directory with name ".helm-release" (without extension).
-		viper.AddConfigPath(home)
 		viper.SetConfigName(".helm-release")
 	}
 
+	viper.SetEnvPrefix("helm_release")
+	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	viper.AutomaticEnv() // read in environment variables that match
 
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		log.Info("Using config file:", viper.ConfigFileUsed())
-	}
+	// If a config file is found, read it in, it is logged once logging is configured.
+	_ = viper.ReadInConfig()
 }
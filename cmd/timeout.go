@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"context"
+	"time"
+)
+
+var timeout time.Duration
+
+// runContext returns the context of a command run, the git commands of the
+// run are stopped once the timeout elapsed
+func runContext() (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func init() {
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Stops the git commands of a run after the duration such as 30s or 5m, 0 waits forever")
+}
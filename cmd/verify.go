@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/sstarcher/helm-release/git"
+	"github.com/sstarcher/helm-release/helm"
+)
+
+// verifyCmd fails when a chart changed without increasing its version
+var verifyCmd = &cobra.Command{
+	Use:   "verify [DIR]",
+	Short: "Fails when the files of a chart changed since the base ref without a version increase",
+	Args:  cobra.MaximumNArgs(1),
+	// a failed verification is not a usage error
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := chartDir(args, 0)
+
+		ctx, cancel := runContext()
+		defer cancel()
+		repo, base, files, err := changedFiles(ctx, dir)
+		if err != nil {
+			return err
+		}
+
+		charts, err := helm.FindCharts(dir, nil)
+		if err != nil {
+			return err
+		}
+
+		changed := map[*helm.Chart]bool{}
+		for _, file := range files {
+			if chart := helm.Owner(charts, file); chart != nil {
+				changed[chart] = true
+			}
+		}
+
+		failures := 0
+		for _, chart := range charts {
+			if !changed[chart] {
+				continue
+			}
+
+			problem, err := verifyChart(ctx, repo, base, dir, chart)
+			if err != nil {
+				return err
+			}
+			if problem != "" {
+				failures++
+				_, err = fmt.Fprintln(cmd.OutOrStdout(), problem)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		if failures > 0 {
+			return fmt.Errorf("%d chart(s) changed since %s without a version increase", failures, base)
+		}
+		return nil
+	},
+}
+
+// verifyChart compares the version of the chart with its version at the base
+// ref and describes the problem when it did not increase
+func verifyChart(ctx context.Context, repo *git.Git, base string, dir string, chart *helm.Chart) (string, error) {
+	file, err := filepath.Rel(dir, filepath.Join(chart.Path(), "Chart.yaml"))
+	if err != nil {
+		return "", err
+	}
+
+	source, ok, err := repo.FileAt(ctx, base, file)
+	if err != nil || !ok {
+		// charts added since the base ref have no version to compare with
+		return "", err
+	}
+
+	old, err := helm.ParseVersion(base+":"+file, source)
+	if err != nil {
+		return "", err
+	}
+	current, err := chart.Get(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case current.LessThan(old):
+		return fmt.Sprintf("%s version went backwards from %s to %s", chart.Path(), old, current), nil
+	case current.Equal(old):
+		return fmt.Sprintf("%s changed but its version %s was not increased", chart.Path(), current), nil
+	}
+	return "", nil
+}
+
+func init() {
+	verifyCmd.Flags().StringVar(&baseRef, "base", "", "Ref the changes are compared against, defaults to the merge base of HEAD and the mainline")
+	verifyCmd.Flags().StringVar(&mainline, "mainline", git.DefaultMainline, "Branch whose merge base with HEAD is the default base ref")
+	rootCmd.AddCommand(verifyCmd)
+}
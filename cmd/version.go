@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Masterminds/semver"
+	"github.com/spf13/cobra"
+	"github.com/sstarcher/helm-release/helm"
+	"github.com/sstarcher/helm-release/release"
+)
+
+// chartDir returns the directory argument at index or the current directory
+func chartDir(args []string, index int) string {
+	if len(args) > index {
+		return args[index]
+	}
+	return "."
+}
+
+// currentCmd prints the current version of the chart
+var currentCmd = &cobra.Command{
+	Use:   "current [CHART_PATH]",
+	Short: "Prints the current version of the chart from the version source",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := runContext()
+		defer cancel()
+		takeSnapshot(ctx, chartDir(args, 0))
+
+		getter, err := release.Getter(ctx, chartDir(args, 0), releaseOptions(cmd))
+		if err != nil {
+			return err
+		}
+
+		ver, err := getter.Get(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), ver.String())
+		return err
+	},
+}
+
+// nextCmd prints the next version of the chart
+var nextCmd = &cobra.Command{
+	Use:   "next [CHART_PATH]",
+	Short: "Prints the next version of the chart from the version source",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx, cancel := runContext()
+		defer cancel()
+		takeSnapshot(ctx, chartDir(args, 0))
+		ver, err := nextVersion(ctx, cmd, chartDir(args, 0), os.Stderr)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), ver.String())
+		return err
+	},
+}
+
+// setCmd writes a version to Chart.yaml
+var setCmd = &cobra.Command{
+	Use:   "set VERSION [CHART_PATH]",
+	Short: "Sets the version in Chart.yaml",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ver, err := semver.NewVersion(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid version %s %s", args[0], err)
+		}
+
+		chart, err := helm.New(chartDir(args, 1), nil)
+		if err != nil {
+			return err
+		}
+		return chart.Set(ver)
+	},
+}
+
+// bumpCmd computes the next version with the given bump and releases it
+var bumpCmd = &cobra.Command{
+	Use:   "bump major|minor|patch [CHART_PATH]",
+	Short: "Bumps the version of the chart and updates the chart like the root command",
+	Args:  cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "major", "minor", "patch":
+		default:
+			return fmt.Errorf("invalid input for bump %s expected major, minor or patch", args[0])
+		}
+
+		ctx, cancel := runContext()
+		defer cancel()
+		bump = args[0]
+		return runRelease(ctx, cmd, chartDir(args, 1))
+	},
+}
+
+func init() {
+	addSourceFlags(currentCmd.Flags())
+
+	addSourceFlags(nextCmd.Flags())
+	nextCmd.Flags().StringVar(&bump, "bump", "", "Specifies to bump major, minor, or patch")
+
+	addSourceFlags(bumpCmd.Flags())
+	addUpdateFlags(bumpCmd.Flags())
+
+	rootCmd.AddCommand(currentCmd, nextCmd, setCmd, bumpCmd)
+}
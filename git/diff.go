@@ -0,0 +1,88 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMainline is the branch changes are compared against by default
+const DefaultMainline = "master"
+
+// MergeBase returns the commit where HEAD forked from ref
+func (g *Git) MergeBase(ctx context.Context, ref string) (string, error) {
+	out, err := g.run(ctx, "merge-base", "HEAD", ref)
+	if err != nil {
+		return "", fmt.Errorf("unable to find the merge base of HEAD and %s %w", ref, err)
+	}
+	return out, nil
+}
+
+// toplevel returns the root directory of the repository
+func (g *Git) toplevel(ctx context.Context) (string, error) {
+	state, err := g.snapshot(ctx)
+	if err != nil {
+		return "", fmt.Errorf("unable to find the root of the repository %w", err)
+	}
+	return state.Root, nil
+}
+
+// ChangedFiles returns the absolute paths of the files that differ between
+// the base ref and the working tree, including uncommitted and untracked
+// files
+func (g *Git) ChangedFiles(ctx context.Context, base string) ([]string, error) {
+	root, err := g.toplevel(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := g.run(ctx, "diff", "--name-only", "--no-renames", base, "--")
+	if err != nil {
+		return nil, fmt.Errorf("unable to diff against %s %w", base, err)
+	}
+
+	untracked, err := g.run(ctx, "-C", root, "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, name := range strings.Split(out+"\n"+untracked, "\n") {
+		if name != "" {
+			files = append(files, filepath.Join(root, filepath.FromSlash(name)))
+		}
+	}
+	return files, nil
+}
+
+// FileAt returns the contents of the file at the ref, the path is relative to
+// the directory of the repository, and false when the file does not exist
+// at the ref
+func (g *Git) FileAt(ctx context.Context, ref string, path string) ([]byte, bool, error) {
+	object := ref + ":./" + filepath.ToSlash(path)
+	// ls-tree lists nothing for a missing file but fails for an unknown ref
+	found, err := g.run(ctx, "ls-tree", "--name-only", ref, "--", "./"+filepath.ToSlash(path))
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to find %s at %s %w", path, ref, err)
+	}
+	if found == "" {
+		return nil, false, nil
+	}
+
+	// the contents are read from stdout only and kept byte for byte
+	out, err := command(ctx, g.directory, "cat-file", "blob", object).Output()
+	if stopped := contextError(ctx, []string{"cat-file"}); stopped != nil {
+		return nil, false, stopped
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			err = fmt.Errorf("%s %w", strings.TrimSpace(string(exitErr.Stderr)), err)
+		}
+		return nil, false, fmt.Errorf("unable to read %s at %s %w", path, ref, err)
+	}
+	return out, true, nil
+}
@@ -0,0 +1,64 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangedFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+	dir, _ = filepath.EvalSymlinks(dir)
+
+	assert.Nil(os.MkdirAll(filepath.Join(dir, "charts", "app"), 0755))
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "charts", "app", "Chart.yaml"), []byte("version: 1.0.0\n"), 0644))
+	runGit(t, dir, "add", "-A")
+	commit(t, dir, "chart")
+
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "charts", "app", "values.yaml"), []byte("image: {}\n"), 0644))
+	runGit(t, dir, "add", "-A")
+	commit(t, dir, "values")
+	assert.Nil(ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("readme\n"), 0644))
+
+	git := Git{directory: filepath.Join(dir, "charts")}
+	base, err := git.MergeBase(context.Background(), DefaultMainline)
+	assert.Nil(err)
+	assert.Equal(runGit(t, dir, "rev-parse", "master"), base)
+
+	files, err := git.ChangedFiles(context.Background(), base)
+	assert.Nil(err)
+	assert.Equal([]string{
+		filepath.Join(dir, "charts", "app", "values.yaml"),
+		filepath.Join(dir, "README.md"),
+	}, files)
+
+	source, ok, err := git.FileAt(context.Background(), base, "app/Chart.yaml")
+	assert.Nil(err)
+	assert.True(ok)
+	assert.Equal("version: 1.0.0\n", string(source))
+
+	_, ok, err = git.FileAt(context.Background(), base, "app/values.yaml")
+	assert.Nil(err)
+	assert.False(ok)
+
+	_, _, err = git.FileAt(context.Background(), "missing", "app/Chart.yaml")
+	assert.NotNil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, ok, err = git.FileAt(ctx, base, "app/Chart.yaml")
+	assert.True(errors.Is(err, context.Canceled))
+	assert.False(ok)
+
+	_, err = git.MergeBase(context.Background(), "missing")
+	assert.NotNil(err)
+}
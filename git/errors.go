@@ -0,0 +1,12 @@
+package git
+
+import "errors"
+
+var (
+	// ErrNoTags is returned when no release tag can be found in the history
+	ErrNoTags = errors.New("no release tags found")
+	// ErrLightweightTag is returned when HEAD is tagged with a lightweight tag
+	ErrLightweightTag = errors.New("lightweight tag")
+	// ErrTagsOutOfSync is matched by OutOfSyncError
+	ErrTagsOutOfSync = errors.New("tags out of sync")
+)
@@ -1,6 +1,7 @@
 package git
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
@@ -11,61 +12,142 @@ import (
 
 	"github.com/Masterminds/semver"
 	log "github.com/sirupsen/logrus"
+	"github.com/sstarcher/helm-release/internal/errkind"
 	"github.com/sstarcher/helm-release/version"
 )
 
+// Git computes versions from the tags of a git repository
 type Git struct {
-	directory string
+	directory   string
+	options     Options
+	maintenance []*regexp.Regexp
+	format      tagFormat
+	state       *Snapshot
+}
+
+// Options configures how the git source selects tags
+type Options struct {
+	// Merged limits the tags to those reachable from HEAD
+	Merged bool
+	// Branch limits the tags to those reachable from the given branch
+	Branch string
+	// Pattern limits the tags to those matching the glob
+	Pattern string
+	// Maintenance lists branch patterns with the named groups major and minor
+	// whose branches are constrained to that release line
+	Maintenance []string
+	// TagPrefix is the literal prefix in front of the version of release tags
+	TagPrefix string
+	// TagPattern is a regular expression with the named group version
+	// matching release tags, tags are created as TagPrefix followed by the version
+	TagPattern string
+	// Shallow selects how a shallow clone without a release tag is handled,
+	// fail (default), unshallow or deepen
+	Shallow string
+	// Env looks up the variables overriding the git history such as LAST_TAG
+	// and BRANCH_NAME, by default from the process environment
+	Env func(key string) (string, bool)
+	// Snapshot is the repository state shared with other charts of the run,
+	// by default it is collected on first use. It is ignored when the
+	// directory is outside of its repository.
+	Snapshot *Snapshot
+}
+
+// Tag is a git tag that parsed as a semantic version
+type Tag struct {
+	Name    string
+	Version *semver.Version
 }
 
 // New creates the structure
-func New(directory string) (version.Getter, error) {
-	err := validate(directory)
+func New(ctx context.Context, directory string, options *Options) (*Git, error) {
+	g := &Git{
+		directory: directory,
+	}
+	if options != nil {
+		g.options = *options
+	}
+
+	var err error
+	if g.options.Snapshot != nil && g.options.Snapshot.contains(directory) {
+		g.state = g.options.Snapshot
+	} else {
+		err = validate(ctx, directory)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	g.maintenance, err = compileMaintenance(g.options.Maintenance)
 	if err != nil {
 		return nil, err
 	}
-	return &Git{
-		directory: directory,
-	}, nil
-}
 
-// ~r4.8-40-g56a99c2~
-func (g *Git) tag() (tag string, err error) {
-	tag, exists := os.LookupEnv("LAST_TAG")
-	if exists {
-		return
+	g.format, err = newTagFormat(g.options.TagPrefix, g.options.TagPattern)
+	if err != nil {
+		return nil, err
 	}
 
-	s, err := g.run("describe", "--tags")
+	err = validateShallow(g.options.Shallow)
 	if err != nil {
-		return
+		return nil, err
 	}
+	return g, nil
+}
 
-	tag, err = g.run("describe", "--tags", "--abbrev=0")
-	if err != nil {
-		return
+// lookupEnv looks up the variable in the environment of the options
+func (g *Git) lookupEnv(key string) (string, bool) {
+	if g.options.Env == nil {
+		return os.LookupEnv(key)
 	}
+	return g.options.Env(key)
+}
+
+// getenv returns the variable from the environment of the options
+func (g *Git) getenv(key string) string {
+	value, _ := g.lookupEnv(key)
+	return value
+}
 
-	if tag == s {
-		return tag, nil
+// Directory returns the directory of the repository the versions are computed in
+func (g *Git) Directory() string {
+	return g.directory
+}
+
+// snapshot returns the repository state, collecting it on first use
+func (g *Git) snapshot(ctx context.Context) (*Snapshot, error) {
+	if g.state != nil {
+		return g.state, nil
 	}
+	return g.refresh(ctx)
+}
 
-	// TAG-COMMITS-gSHA
-	items := strings.Split(s, "-")
-	if len(items) < 3 {
-		err = fmt.Errorf("unknown response from git describe --tags [%s]", s)
-		return
+// refresh collects the repository state again after the history changed
+func (g *Git) refresh(ctx context.Context) (*Snapshot, error) {
+	state, err := NewSnapshot(ctx, g.directory)
+	if err != nil {
+		return nil, err
 	}
+	g.state = state
+	return state, nil
+}
 
-	if tag == "" {
-		tag = strings.Join(items[0:len(items)-2], "-")
+// ~r4.8-40-g56a99c2~
+func (g *Git) tag(ctx context.Context) (tag string, err error) {
+	tag, exists := g.lookupEnv("LAST_TAG")
+	if exists {
+		return
 	}
 
-	return
+	s, err := g.describe(ctx)
+	if err != nil {
+		return
+	}
+	return describedTag(s), nil
 }
 
-func (g *Git) isTagged() bool {
-	tag := os.Getenv("IS_TAGGED")
+func (g *Git) isTagged(ctx context.Context) bool {
+	tag := g.getenv("IS_TAGGED")
 	if tag != "" {
 		b, err := strconv.ParseBool(tag)
 		if err != nil {
@@ -74,12 +156,13 @@ func (g *Git) isTagged() bool {
 		return b
 	}
 
-	_, err := g.run("describe", "--exact-match", "--tags")
-	return err == nil
+	// describe prints only the tag when HEAD is tagged
+	s, err := g.describe(ctx)
+	return err == nil && describedTag(s) == s
 }
 
-func (g *Git) commits() (commits int, err error) {
-	commitStr := os.Getenv("COMMITS")
+func (g *Git) commits(ctx context.Context) (commits int, err error) {
+	commitStr := g.getenv("COMMITS")
 	commits = -1
 	if commitStr != "" {
 		commits, err = strconv.Atoi(commitStr)
@@ -93,15 +176,13 @@ func (g *Git) commits() (commits int, err error) {
 		return
 	}
 
-	s, err := g.run("describe", "--tags")
+	s, err := g.describe(ctx)
 	if err != nil {
-		s, err = g.run("rev-list", "--count", "HEAD")
+		state, err := g.snapshot(ctx)
 		if err != nil {
-			return
+			return 0, err
 		}
-
-		commits, err = strconv.Atoi(s)
-		return
+		return state.commitCount(ctx, g.directory)
 	}
 
 	// TAG-COMMITS-gSHA
@@ -119,30 +200,46 @@ func (g *Git) commits() (commits int, err error) {
 }
 
 // Sha returns the short git sha of the repo
-func (g *Git) sha() (string, error) {
-	sha := os.Getenv("SHA")
+func (g *Git) sha(ctx context.Context) (string, error) {
+	sha := g.getenv("SHA")
 	if sha != "" {
 		if len(sha) == 7 {
 			return sha, nil
 		}
 
-		log.Warnf("ignoring the environment variable SHA it is not of length 7 [%s]", sha)
+		log.WithField("directory", g.directory).Warnf("ignoring the environment variable SHA it is not of length 7 [%s]", sha)
 		sha = ""
 	}
 
-	return g.run("rev-parse", "--short", "HEAD")
+	state, err := g.snapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+	if state.Head == "" {
+		return "", fmt.Errorf("HEAD of %s does not point to a commit", state.Root)
+	}
+	return state.Head, nil
 }
 
-// Branch returns the branch reference of the repo
-func (g *Git) branch() (string, error) {
-	branch := os.Getenv("BRANCH_NAME")
+// rawBranch returns the unmodified branch name of the repo
+func (g *Git) rawBranch(ctx context.Context) (string, error) {
+	branch := g.getenv("BRANCH_NAME")
+	if branch != "" {
+		return branch, nil
+	}
 
-	if branch == "" {
-		var err error
-		branch, err = g.run("rev-parse", "--abbrev-ref", "HEAD")
-		if err != nil {
-			return "", err
-		}
+	state, err := g.snapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+	return state.Branch, nil
+}
+
+// Branch returns the branch reference of the repo
+func (g *Git) branch(ctx context.Context) (string, error) {
+	branch, err := g.rawBranch(ctx)
+	if err != nil {
+		return "", err
 	}
 
 	reg, err := regexp.Compile("[^0-9A-Za-z-]+")
@@ -154,53 +251,150 @@ func (g *Git) branch() (string, error) {
 	return strings.ToLower(branch), err
 }
 
+// line returns the maintenance line of the current branch if it has one
+func (g *Git) line(ctx context.Context) (*Line, error) {
+	if len(g.maintenance) == 0 {
+		return nil, nil
+	}
+
+	branch, err := g.rawBranch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch git branch %w", err)
+	}
+	return matchLine(g.maintenance, branch)
+}
+
+// maxDescribe bounds how many non release tags are skipped by describe
+const maxDescribe = 100
+
+// describe runs git describe limited to release tags of the tag format
+// and the maintenance line, the result is shared through the snapshot
+func (g *Git) describe(ctx context.Context) (string, error) {
+	line, err := g.line(ctx)
+	if err != nil {
+		return "", err
+	}
+	state, err := g.snapshot(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	glob := g.format.glob(line)
+	key := fmt.Sprintf("%s %v %v", glob, g.format.pattern, line)
+	return state.describe(ctx, key, func() (string, error) {
+		args := []string{"describe", "--tags", "--match", glob}
+		for i := 0; i < maxDescribe; i++ {
+			s, err := g.run(ctx, args...)
+			if err != nil {
+				return s, err
+			}
+
+			tag := describedTag(s)
+			ver, err := g.format.parse(tag)
+			if err == nil && (line == nil || line.Contains(ver)) {
+				return s, nil
+			}
+			args = append(args, "--exclude", tag)
+		}
+		return "", errkind.New(fmt.Sprintf("unable to find a release tag within %d tags", maxDescribe), ErrNoTags)
+	})
+}
+
 // Get the semantic version from git
-func (g *Git) Get() (*semver.Version, error) {
-	tag, err := g.tag()
+func (g *Git) Get(ctx context.Context) (*semver.Version, error) {
+	return g.get(ctx, true)
+}
+
+// Latest returns the version of the latest release tag, unlike Get it fails
+// with ErrNoTags instead of starting from an initial version
+func (g *Git) Latest(ctx context.Context) (*semver.Version, error) {
+	return g.get(ctx, false)
+}
+
+// get returns the version of the latest release tag, initial falls back to
+// the first version of the maintenance line or 0.0.1 without a release tag
+func (g *Git) get(ctx context.Context, initial bool) (*semver.Version, error) {
+	err := g.ensureHistory(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := g.line(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ver *semver.Version
+	tag, err := g.tag(ctx)
+	if err != nil && ctx.Err() != nil {
+		return nil, err // stopped instead of missing tags
+	}
+	if (err != nil || tag == "") && !initial {
+		if err != nil && !errors.Is(err, ErrNoTags) {
+			return nil, err
+		}
+		return nil, errkind.New(fmt.Sprintf("no release tag matches %s", g.format.glob(line)), ErrNoTags)
+	}
 	if err != nil || tag == "" {
 		tag = "0.0.1"
-		log.Infof("unable to find any git tags using %s", tag)
+		if line != nil {
+			tag = line.String() + ".0"
+		}
+		log.WithField("directory", g.directory).Infof("unable to find any git tags using %s", tag)
+		ver, err = semver.NewVersion(tag)
+	} else {
+		ver, err = g.format.parse(tag)
 	}
-
-	tag = strings.TrimPrefix(tag, "v")
-	tag = strings.TrimPrefix(tag, "r")
-	ver, err := semver.NewVersion(tag)
 	if err != nil {
 		return nil, fmt.Errorf("%s %s", tag, err)
 	}
+
+	if line != nil && !line.Contains(ver) {
+		return nil, fmt.Errorf("tag %s is outside of the maintenance line %s", tag, line)
+	}
 	return ver, nil
 }
 
-func (g *Git) versionFromHistory(ver *semver.Version) (*semver.Version, error) {
-	commits, err := g.commits()
+func (g *Git) versionFromHistory(ctx context.Context, ver *semver.Version) (*semver.Version, error) {
+	commits, err := g.commits(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	sha, err := g.sha()
+	sha, err := g.sha(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch git sha %s", err)
+		return nil, fmt.Errorf("failed to fetch git sha %w", err)
 	}
 
-	branch, err := g.branch()
+	branch, err := g.branch(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch git branch %s", err)
+		return nil, fmt.Errorf("failed to fetch git branch %w", err)
+	}
+
+	line, err := g.line(ctx)
+	if err != nil {
+		return nil, err
 	}
+	// maintenance branches are released like master within their line
+	mainline := branch == "master" || line != nil
 
 	version := *ver
 	prerel := ""
-	tagged := g.isTagged()
+	tagged := g.isTagged(ctx)
+	if stopped := contextError(ctx, []string{"describe"}); stopped != nil {
+		return nil, stopped
+	}
 	if !tagged {
 		if branch == "head" && commits == 0 {
-			return nil, errors.New("this is likely an light-weight git tag. please use a annotated tag for helm release to function properly")
+			return nil, errkind.New("this is likely an light-weight git tag. please use a annotated tag for helm release to function properly", ErrLightweightTag)
 		}
 		version = version.IncPatch()
-		if branch != "master" {
+		if !mainline {
 			prerel = "0." + branch
 		}
 	}
 
-	if branch == "master" {
+	if mainline {
 		if commits != 0 {
 			if prerel != "" {
 				prerel += "."
@@ -220,24 +414,40 @@ func (g *Git) versionFromHistory(ver *semver.Version) (*semver.Version, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// the tag is empty when the version starts without a release tag
+	tag, _ := g.tag(ctx)
+	log.WithFields(log.Fields{
+		"directory": g.directory,
+		"tag":       tag,
+		"previous":  ver.String(),
+		"branch":    branch,
+		"commits":   commits,
+		"version":   version.String(),
+	}).Debug("computed the version from the git history")
 	return &version, err
 }
 
 // NextVersion determines the correct version
-func (g *Git) NextVersion(nextType *version.NextType) (*semver.Version, error) {
-	ver, err := g.Get()
+func (g *Git) NextVersion(ctx context.Context, nextType *version.NextType) (*semver.Version, error) {
+	ver, err := g.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := g.tags(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	tags, err := g.tags()
+	line, err := g.line(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	var nextVersion *semver.Version
 	if nextType == nil { // Determine from git history
-		nextVersion, err = g.versionFromHistory(ver)
+		nextVersion, err = g.versionFromHistory(ctx, ver)
 		if err != nil {
 			return nil, err
 		}
@@ -248,58 +458,137 @@ func (g *Git) NextVersion(nextType *version.NextType) (*semver.Version, error) {
 		}
 	}
 
-	wrongTags := false
+	if line != nil && !line.Contains(nextVersion) {
+		return nil, fmt.Errorf("next version %s is outside of the maintenance line %s", nextVersion, line)
+	}
+
+	wrongTags := []Tag{}
 	for _, item := range tags {
-		if nextVersion.Compare(item) != 1 {
-			wrongTags = true
-			log.Warnf("next version is behind one of the semver tags %v", item)
+		if line != nil && !line.Contains(item.Version) {
+			continue // only the tags of the maintenance line are ordered against it
+		}
+		if nextVersion.Compare(item.Version) != 1 {
+			wrongTags = append(wrongTags, item)
+			log.WithFields(log.Fields{
+				"directory": g.directory,
+				"tag":       item.Name,
+				"version":   nextVersion.String(),
+			}).Warnf("next version is behind one of the semver tags %v", item.Version)
 		}
 	}
 
-	if wrongTags {
-		err = fmt.Errorf("tags in history are out of sync with next version %d.%d.%d", nextVersion.Major(), nextVersion.Minor(), nextVersion.Patch())
+	if len(wrongTags) > 0 {
+		err = &OutOfSyncError{
+			Version: nextVersion,
+			Report:  g.syncReport(ctx, nextVersion, wrongTags),
+		}
 	}
 
 	return nextVersion, err
 }
 
-func (g *Git) tags() ([]*semver.Version, error) {
-	cmd := exec.Command("git", "tag")
-	cmd.Dir = g.directory
-	out, err := cmd.CombinedOutput()
+// tags lists the semver tags limited by the configured filters
+func (g *Git) tags(ctx context.Context) ([]Tag, error) {
+	state, err := g.snapshot(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	s := strings.TrimSpace(string(out))
-	tagString := strings.Split(s, "\n")
-	tags := []*semver.Version{}
-	for _, item := range tagString {
-		ver, err := semver.NewVersion(item)
+	var merged map[string]bool
+	if g.options.Branch != "" {
+		merged, err = state.mergedInto(ctx, g.directory, g.options.Branch)
+	} else if g.options.Merged {
+		merged, err = state.mergedInto(ctx, g.directory, "HEAD")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	glob := g.options.Pattern
+	if glob == "" {
+		glob = g.format.glob(nil)
+	}
+
+	tags := []Tag{}
+	for _, item := range state.Tags {
+		if merged != nil && !merged[item.Name] || !globMatch(glob, item.Name) {
+			continue
+		}
+		ver, err := g.format.parse(item.Name)
 		if err == nil {
-			tags = append(tags, ver)
+			tags = append(tags, Tag{Name: item.Name, Version: ver})
 		}
 	}
 
 	return tags, nil
 }
 
-func validate(dir string) error {
-	cmd := exec.Command("git", "rev-parse", "--git-dir")
-	cmd.Dir = dir
-	err := cmd.Run()
+// TagName returns the name of the release tag of the version
+func (g *Git) TagName(ver *semver.Version) (string, error) {
+	release, err := ver.SetMetadata("")
+	if err != nil {
+		return "", err
+	}
+	return g.format.name(&release)
+}
 
+// CreateTag creates an annotated release tag for the version at HEAD
+func (g *Git) CreateTag(ctx context.Context, ver *semver.Version) (string, error) {
+	name, err := g.TagName(ver)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := output(ctx, g.directory, "tag", "--annotate", name, "--message", "Release "+name)
+	if err != nil {
+		return "", fmt.Errorf("failed to create tag %s %s %w", name, out, err)
+	}
+	return name, nil
+}
+
+func validate(ctx context.Context, dir string) error {
+	err := command(ctx, dir, "rev-parse", "--git-dir").Run()
+	if stopped := contextError(ctx, []string{"rev-parse"}); stopped != nil {
+		return stopped
+	}
 	return err
 }
 
-func (g *Git) run(command ...string) (result string, err error) {
-	cmd := exec.Command("git", command...)
-	cmd.Dir = g.directory
-	out, err := cmd.CombinedOutput()
+// command returns a git command in dir that is killed once ctx is done and
+// fails instead of prompting for credentials
+func command(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	return cmd
+}
+
+// contextError returns the error of ctx for a git command stopped by it
+func contextError(ctx context.Context, args []string) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+
+	name := args[0]
+	if name == "-C" && len(args) > 2 {
+		name = args[2]
+	}
+	return errkind.New(fmt.Sprintf("git %s was stopped %s", name, ctx.Err()), ctx.Err())
+}
+
+// output runs git in dir and returns its trimmed output
+func output(ctx context.Context, dir string, args ...string) (string, error) {
+	out, err := command(ctx, dir, args...).CombinedOutput()
+	if stopped := contextError(ctx, args); stopped != nil {
+		return "", stopped
+	}
+	return strings.TrimSpace(string(out)), err
+}
 
-	s := strings.TrimSpace(string(out))
+func (g *Git) run(ctx context.Context, args ...string) (result string, err error) {
+	s, err := output(ctx, g.directory, args...)
 	if s == "fatal: No names found, cannot describe anything." {
-		err = errors.New("error processing git repo")
+		err = errkind.New("error processing git repo", ErrNoTags)
 		return
 	} else if err != nil {
 		return
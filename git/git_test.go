@@ -1,9 +1,16 @@
 package git
 
 import (
+	"context"
+	"errors"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/sstarcher/helm-release/version"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -18,15 +25,15 @@ func TestValidGitRepo(t *testing.T) {
 		directory: dir,
 	}
 
-	tag, err := git.tag()
+	tag, err := git.tag(context.Background())
 	assert.Nil(err)
 	assert.NotNil(tag)
 
-	commits, err := git.commits()
+	commits, err := git.commits(context.Background())
 	assert.Nil(err)
 	assert.NotNil(commits)
 
-	sha, err := git.sha()
+	sha, err := git.sha(context.Background())
 	assert.Len(sha, 7)
 }
 
@@ -37,7 +44,7 @@ func TestValidRepoSha(t *testing.T) {
 		directory: dir,
 	}
 
-	result, err := git.sha()
+	result, err := git.sha(context.Background())
 	assert.Nil(err)
 	assert.NotNil(result)
 	assert.Len(result, 7)
@@ -49,7 +56,7 @@ func TestValidRepoBranch(t *testing.T) {
 	git := Git{
 		directory: dir,
 	}
-	result, err := git.branch()
+	result, err := git.branch(context.Background())
 	assert.Nil(err)
 	assert.NotEmpty(result)
 }
@@ -57,7 +64,7 @@ func TestValidRepoBranch(t *testing.T) {
 func TestNoGitRepo(t *testing.T) {
 	assert := assert.New(t)
 
-	git, err := New("cmd")
+	git, err := New(context.Background(), "cmd", nil)
 	assert.NotNil(err)
 	assert.Nil(git)
 }
@@ -78,7 +85,7 @@ func TestBranches(t *testing.T) {
 	}
 	for _, tt := range branchTests {
 		os.Setenv("BRANCH_NAME", tt.branch)
-		actual, err := git.branch()
+		actual, err := git.branch(context.Background())
 		assert.Nil(err)
 		assert.Equal(tt.expected, actual)
 		os.Unsetenv("BRANCH_NAME")
@@ -92,15 +99,15 @@ func TestNoTags(t *testing.T) {
 		directory: noTagsDir,
 	}
 
-	branch, err := git.branch()
+	branch, err := git.branch(context.Background())
 	assert.Nil(err)
 	assert.NotNil(branch)
 
-	commits, err := git.commits()
+	commits, err := git.commits(context.Background())
 	assert.Nil(err)
 	assert.Equal(2, commits)
 
-	tag, err := git.tag()
+	tag, err := git.tag(context.Background())
 	assert.NotNil(err)
 	assert.Empty(tag)
 }
@@ -112,6 +119,233 @@ func TestBadTags(t *testing.T) {
 		directory: badTags,
 	}
 
-	_, err := git.NextVersion(nil)
+	_, err := git.NextVersion(context.Background(), nil)
 	assert.NotNil(err)
 }
+
+// newRepo creates a temporary git repository with a single commit on master
+func newRepo(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "helm-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "config", "user.name", "test")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	runGit(t, dir, "checkout", "-q", "-b", "master")
+	commit(t, dir, "initial")
+	return dir
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %s %s", args, err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func commit(t *testing.T, dir string, msg string) {
+	runGit(t, dir, "commit", "-q", "--allow-empty", "-m", msg)
+}
+
+func TestOutOfSyncReport(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+
+	runGit(t, dir, "tag", "-a", "1.0.0", "-m", "1.0.0")
+	runGit(t, dir, "checkout", "-q", "-b", "release")
+	commit(t, dir, "release")
+	runGit(t, dir, "tag", "-a", "2.0.0", "-m", "2.0.0")
+	runGit(t, dir, "checkout", "-q", "master")
+	commit(t, dir, "next")
+
+	git := Git{
+		directory: dir,
+	}
+
+	ver, err := git.NextVersion(context.Background(), nil)
+	assert.NotNil(ver)
+
+	assert.True(errors.Is(err, ErrTagsOutOfSync))
+	syncErr, ok := err.(*OutOfSyncError)
+	if !assert.True(ok) {
+		return
+	}
+	assert.Equal("tags in history are out of sync with next version 1.0.1", syncErr.Error())
+
+	report := syncErr.Report
+	assert.Len(report.Tags, 1)
+	tag := report.Tags[0]
+	assert.Equal("2.0.0", tag.Tag)
+	assert.False(tag.Reachable)
+	assert.Equal([]string{"release"}, tag.Branches)
+	assert.Contains(tag.Suggestion, "merge or rebase onto release")
+	assert.Contains(report.String(), "reachable from HEAD: false")
+
+	out, err := report.JSON()
+	assert.Nil(err)
+	assert.Contains(string(out), `"reachableFromHead": false`)
+}
+
+func TestLightweightTag(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+
+	env := map[string]string{
+		"LAST_TAG":    "1.0.0",
+		"IS_TAGGED":   "false",
+		"COMMITS":     "0",
+		"SHA":         "abc1234",
+		"BRANCH_NAME": "HEAD",
+	}
+	git, err := New(context.Background(), dir, &Options{Env: func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}})
+	assert.Nil(err)
+
+	_, err = git.NextVersion(context.Background(), nil)
+	assert.True(errors.Is(err, ErrLightweightTag))
+	assert.False(errors.Is(err, ErrNoTags))
+}
+
+func TestTagFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+
+	runGit(t, dir, "tag", "-a", "1.0.0", "-m", "1.0.0")
+	runGit(t, dir, "checkout", "-q", "-b", "hotfix")
+	commit(t, dir, "hotfix")
+	runGit(t, dir, "tag", "-a", "1.0.1", "-m", "1.0.1")
+	runGit(t, dir, "checkout", "-q", "master")
+	commit(t, dir, "feature")
+	runGit(t, dir, "tag", "-a", "1.1.0", "-m", "1.1.0")
+	runGit(t, dir, "tag", "-a", "other-2.0.0", "-m", "other")
+
+	var filterTests = []struct {
+		options  Options
+		expected []string
+	}{
+		{Options{}, []string{"1.0.0", "1.0.1", "1.1.0"}},
+		{Options{Merged: true}, []string{"1.0.0", "1.1.0"}},
+		{Options{Branch: "hotfix"}, []string{"1.0.0", "1.0.1"}},
+		{Options{Pattern: "1.0.*"}, []string{"1.0.0", "1.0.1"}},
+		{Options{Merged: true, Pattern: "1.0.*"}, []string{"1.0.0"}},
+	}
+
+	for _, tt := range filterTests {
+		git := Git{
+			directory: dir,
+			options:   tt.options,
+		}
+
+		tags, err := git.tags(context.Background())
+		assert.Nil(err)
+		names := []string{}
+		for _, tag := range tags {
+			names = append(names, tag.Name)
+		}
+		assert.Equal(tt.expected, names)
+	}
+}
+
+func TestMaintenanceBranch(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+
+	runGit(t, dir, "tag", "-a", "v1.4.0", "-m", "1.4.0")
+	runGit(t, dir, "checkout", "-q", "-b", "release/1.4")
+	commit(t, dir, "fix")
+	runGit(t, dir, "checkout", "-q", "master")
+	commit(t, dir, "feature")
+	runGit(t, dir, "tag", "-a", "v2.0.0", "-m", "2.0.0")
+	commit(t, dir, "feature")
+	runGit(t, dir, "checkout", "-q", "release/1.4")
+
+	source, err := New(context.Background(), dir, &Options{
+		Maintenance: []string{`^release/(?P<major>\d+)\.(?P<minor>\d+)$`},
+	})
+	assert.Nil(err)
+
+	ver, err := source.NextVersion(context.Background(), nil)
+	assert.Nil(err)
+	if assert.NotNil(ver) {
+		assert.Equal("1.4.1-1", ver.String()[:7])
+	}
+
+	major := version.Major
+	_, err = source.NextVersion(context.Background(), &major)
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "outside of the maintenance line 1.4")
+
+	_, err = New(context.Background(), dir, &Options{Maintenance: []string{`^release/(\d+)$`}})
+	assert.NotNil(err)
+}
+
+func TestContext(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+	runGit(t, dir, "tag", "-a", "1.0.0", "-m", "1.0.0")
+
+	source, err := New(context.Background(), dir, nil)
+	assert.Nil(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ver, err := source.NextVersion(ctx, nil)
+	assert.Nil(ver)
+	assert.True(errors.Is(err, context.Canceled))
+	assert.False(errors.Is(err, ErrNoTags))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	_, err = source.MergeBase(ctx, DefaultMainline)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	_, err = New(ctx, dir, nil)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+
+	cmd := command(context.Background(), dir, "status")
+	assert.Contains(cmd.Env, "GIT_TERMINAL_PROMPT=0")
+}
+
+func TestLatest(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+
+	runGit(t, dir, "tag", "1.0.0")
+	git, err := New(context.Background(), dir, &Options{TagPrefix: "app-v"})
+	assert.Nil(err)
+
+	ver, err := git.Get(context.Background())
+	assert.Nil(err)
+	assert.Equal("0.0.1", ver.String())
+
+	_, err = git.Latest(context.Background())
+	assert.True(errors.Is(err, ErrNoTags))
+
+	runGit(t, dir, "tag", "app-v2.0.0")
+	git, err = New(context.Background(), dir, &Options{TagPrefix: "app-v"})
+	assert.Nil(err)
+	ver, err = git.Latest(context.Background())
+	assert.Nil(err)
+	if assert.NotNil(ver) {
+		assert.Equal("2.0.0", ver.String())
+	}
+}
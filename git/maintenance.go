@@ -0,0 +1,73 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/Masterminds/semver"
+)
+
+// Line is the major.minor release line a maintenance branch is constrained to
+type Line struct {
+	Major int64
+	Minor int64
+}
+
+// String returns the line as major.minor
+func (l *Line) String() string {
+	return fmt.Sprintf("%d.%d", l.Major, l.Minor)
+}
+
+// Contains reports whether the version belongs to the line
+func (l *Line) Contains(ver *semver.Version) bool {
+	return ver.Major() == l.Major && ver.Minor() == l.Minor
+}
+
+// compileMaintenance parses the maintenance branch patterns which must
+// capture the line with the named groups major and minor
+func compileMaintenance(patterns []string) ([]*regexp.Regexp, error) {
+	result := []*regexp.Regexp{}
+	for _, pattern := range patterns {
+		reg, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance branch pattern %s %s", pattern, err)
+		}
+
+		groups := map[string]bool{}
+		for _, name := range reg.SubexpNames() {
+			groups[name] = true
+		}
+		if !groups["major"] || !groups["minor"] {
+			return nil, fmt.Errorf("maintenance branch pattern %s must contain the named groups major and minor", pattern)
+		}
+		result = append(result, reg)
+	}
+	return result, nil
+}
+
+// matchLine returns the line of the first pattern matching the branch
+func matchLine(patterns []*regexp.Regexp, branch string) (*Line, error) {
+	for _, reg := range patterns {
+		match := reg.FindStringSubmatch(branch)
+		if match == nil {
+			continue
+		}
+
+		line := &Line{}
+		for i, name := range reg.SubexpNames() {
+			var err error
+			switch name {
+			case "major":
+				line.Major, err = strconv.ParseInt(match[i], 10, 64)
+			case "minor":
+				line.Minor, err = strconv.ParseInt(match[i], 10, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("branch %s does not contain a valid release line %s", branch, err)
+			}
+		}
+		return line, nil
+	}
+	return nil, nil
+}
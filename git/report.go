@@ -0,0 +1,131 @@
+package git
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// TagReport describes a single semver tag that is ahead of the next version
+type TagReport struct {
+	Tag        string   `json:"tag"`
+	Version    string   `json:"version"`
+	Commit     string   `json:"commit"`
+	Branches   []string `json:"branches"`
+	Reachable  bool     `json:"reachableFromHead"`
+	Suggestion string   `json:"suggestion"`
+}
+
+// SyncReport lists every tag that is out of sync with the computed next version
+type SyncReport struct {
+	NextVersion string      `json:"nextVersion"`
+	Head        string      `json:"head"`
+	Tags        []TagReport `json:"tags"`
+}
+
+// OutOfSyncError is returned when semver tags exist that are not behind the next version
+type OutOfSyncError struct {
+	Version *semver.Version
+	Report  *SyncReport
+}
+
+// Is matches ErrTagsOutOfSync
+func (e *OutOfSyncError) Is(target error) bool {
+	return target == ErrTagsOutOfSync
+}
+
+func (e *OutOfSyncError) Error() string {
+	return fmt.Sprintf("tags in history are out of sync with next version %d.%d.%d", e.Version.Major(), e.Version.Minor(), e.Version.Patch())
+}
+
+// JSON renders the report as indented JSON
+func (r *SyncReport) JSON() ([]byte, error) {
+	return json.MarshalIndent(r, "", "  ")
+}
+
+// String renders the report as human readable text
+func (r *SyncReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "next version %s at %s is not ahead of %d semver tag(s)\n", r.NextVersion, r.Head, len(r.Tags))
+	for _, t := range r.Tags {
+		fmt.Fprintf(&b, "  %s (%s) at commit %s\n", t.Tag, t.Version, t.Commit)
+		fmt.Fprintf(&b, "    reachable from HEAD: %t\n", t.Reachable)
+		branches := "none"
+		if len(t.Branches) > 0 {
+			branches = strings.Join(t.Branches, ", ")
+		}
+		fmt.Fprintf(&b, "    branches: %s\n", branches)
+		fmt.Fprintf(&b, "    suggestion: %s\n", t.Suggestion)
+	}
+	return b.String()
+}
+
+// syncReport gathers commit and branch information for each out of sync tag
+func (g *Git) syncReport(ctx context.Context, next *semver.Version, tags []Tag) *SyncReport {
+	report := &SyncReport{
+		NextVersion: next.String(),
+		Tags:        []TagReport{},
+	}
+
+	commits := map[string]string{}
+	var merged map[string]bool
+	if state, err := g.snapshot(ctx); err == nil {
+		report.Head = state.Head
+		for _, ref := range state.Tags {
+			commits[ref.Name] = ref.Commit
+		}
+		merged, _ = state.mergedInto(ctx, g.directory, "HEAD")
+	}
+
+	for _, tag := range tags {
+		item := TagReport{
+			Tag:      tag.Name,
+			Version:  tag.Version.String(),
+			Branches: []string{},
+		}
+
+		if commit, ok := commits[tag.Name]; ok {
+			item.Commit = commit
+			item.Branches = g.branchesContaining(ctx, commit)
+			item.Reachable = merged[tag.Name]
+		}
+
+		item.Suggestion = suggestion(item)
+		report.Tags = append(report.Tags, item)
+	}
+	return report
+}
+
+// branchesContaining lists the local and remote branches that contain the commit
+func (g *Git) branchesContaining(ctx context.Context, commit string) []string {
+	branches := []string{}
+	out, err := g.run(ctx, "branch", "--all", "--contains", commit, "--format=%(refname:short)")
+	if err != nil || out == "" {
+		return branches
+	}
+
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "(") {
+			continue // detached HEAD entries
+		}
+		branches = append(branches, line)
+	}
+	return branches
+}
+
+func suggestion(t TagReport) string {
+	switch {
+	case t.Commit == "":
+		return fmt.Sprintf("unable to resolve the commit for %s, verify the tag exists locally", t.Tag)
+	case t.Reachable:
+		return fmt.Sprintf("%s is already in the history of HEAD, tag HEAD with a version greater than %s", t.Tag, t.Version)
+	case len(t.Branches) > 0:
+		return fmt.Sprintf("merge or rebase onto %s which contains %s", t.Branches[0], t.Tag)
+	default:
+		return fmt.Sprintf("%s is not on any branch, delete it with 'git tag -d %s' or merge commit %s", t.Tag, t.Tag, t.Commit)
+	}
+}
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/sstarcher/helm-release/internal/errkind"
+)
+
+// Shallow clone strategies
+const (
+	ShallowFail      = "fail"
+	ShallowUnshallow = "unshallow"
+	ShallowDeepen    = "deepen"
+)
+
+// deepenBy is the number of commits fetched per deepen attempt
+const deepenBy = 50
+
+func validateShallow(mode string) error {
+	switch mode {
+	case "", ShallowFail, ShallowUnshallow, ShallowDeepen:
+		return nil
+	}
+	return fmt.Errorf("invalid input for shallow %s expected %s, %s or %s", mode, ShallowFail, ShallowUnshallow, ShallowDeepen)
+}
+
+// ensureHistory makes sure a shallow clone contains a release tag before
+// versions are computed from it
+func (g *Git) ensureHistory(ctx context.Context) error {
+	_, hasTag := g.lookupEnv("LAST_TAG")
+	if hasTag && g.getenv("COMMITS") != "" {
+		return nil // history is provided by the environment
+	}
+
+	state, err := g.snapshot(ctx)
+	if err != nil || !state.Shallow {
+		return err
+	}
+
+	if _, err := g.describe(ctx); err == nil {
+		return nil
+	}
+
+	if shared := g.options.Snapshot; state == shared {
+		// charts sharing the snapshot fetch one at a time and another chart
+		// of the run may have fetched the history already
+		shared.fetch.Lock()
+		defer shared.fetch.Unlock()
+		state, err = g.refresh(ctx)
+		if err != nil || !state.Shallow {
+			return err
+		}
+		if _, err := g.describe(ctx); err == nil {
+			return nil
+		}
+	}
+
+	switch g.options.Shallow {
+	case ShallowUnshallow:
+		log.WithField("directory", g.directory).Info("fetching the full history of the shallow repository")
+		_, err = g.run(ctx, "fetch", "--unshallow", "--tags")
+		if err != nil {
+			return fmt.Errorf("failed to unshallow the repository %w", err)
+		}
+		_, err = g.refresh(ctx)
+		return err
+	case ShallowDeepen:
+		for state.Shallow {
+			log.WithFields(log.Fields{"directory": g.directory, "commits": deepenBy}).Info("deepening the shallow repository")
+			_, err = g.run(ctx, "fetch", "--deepen="+strconv.Itoa(deepenBy), "--tags")
+			if err != nil {
+				return fmt.Errorf("failed to deepen the repository %w", err)
+			}
+
+			state, err = g.refresh(ctx)
+			if err != nil {
+				return err
+			}
+			if _, err := g.describe(ctx); err == nil {
+				return nil
+			}
+		}
+		return nil
+	default:
+		return errkind.New(fmt.Sprintf("%s is a shallow clone without a release tag in its history, fetch the history with 'git fetch --unshallow --tags' or use --shallow %s or %s", g.directory, ShallowUnshallow, ShallowDeepen), ErrNoTags)
+	}
+}
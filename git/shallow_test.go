@@ -0,0 +1,68 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// shallowClone clones the repository with a depth of one
+func shallowClone(t *testing.T, origin string) string {
+	dir, err := ioutil.TempDir("", "helm-release-shallow")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clone := filepath.Join(dir, "clone")
+	runGit(t, dir, "clone", "-q", "--depth=1", "file://"+origin, clone)
+	return clone
+}
+
+func TestShallowClone(t *testing.T) {
+	assert := assert.New(t)
+
+	origin := newRepo(t)
+	defer os.RemoveAll(origin)
+	runGit(t, origin, "tag", "-a", "1.0.0", "-m", "1.0.0")
+	commit(t, origin, "one")
+	commit(t, origin, "two")
+
+	var shallowTests = []struct {
+		mode     string
+		expected string // empty when an error is expected
+	}{
+		{"", ""},
+		{ShallowFail, ""},
+		{ShallowUnshallow, "1.0.1-2"},
+		{ShallowDeepen, "1.0.1-2"},
+	}
+
+	for _, tt := range shallowTests {
+		clone := shallowClone(t, origin)
+		defer os.RemoveAll(filepath.Dir(clone))
+
+		source, err := New(context.Background(), clone, &Options{Shallow: tt.mode})
+		assert.Nil(err)
+
+		ver, err := source.NextVersion(context.Background(), nil)
+		if tt.expected == "" {
+			assert.Nil(ver)
+			if assert.NotNil(err) {
+				assert.Contains(err.Error(), "shallow clone")
+			}
+			continue
+		}
+
+		assert.Nil(err)
+		if assert.NotNil(ver, tt.mode) {
+			assert.Equal(tt.expected, ver.String()[:7])
+		}
+	}
+
+	_, err := New(context.Background(), origin, &Options{Shallow: "sometimes"})
+	assert.NotNil(err)
+}
@@ -0,0 +1,219 @@
+package git
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Snapshot is the state of a repository collected once and shared by the
+// version computations of a run instead of querying git for every chart.
+// The repository is not expected to change while the snapshot is in use.
+type Snapshot struct {
+	// Root is the top level directory of the repository
+	Root string
+	// Head is the short sha of HEAD, empty before the first commit
+	Head string
+	// Branch is the branch checked out or HEAD when detached
+	Branch string
+	// Shallow is set for shallow clones
+	Shallow bool
+	// Tags are all tags of the repository sorted by name
+	Tags []TagRef
+
+	mu      sync.Mutex
+	fetch   sync.Mutex
+	results map[string]*result
+}
+
+// result is a cached git query, done is closed once value and err are set
+type result struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	stopped bool
+}
+
+// TagRef is a tag of the repository and the short sha of the commit it
+// points to
+type TagRef struct {
+	Name   string
+	Commit string
+}
+
+// NewSnapshot collects the state of the repository containing directory
+func NewSnapshot(ctx context.Context, directory string) (*Snapshot, error) {
+	s := &Snapshot{results: map[string]*result{}}
+
+	out, err := output(ctx, directory, "rev-parse", "--show-toplevel", "--is-shallow-repository")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the repository %s %w", directory, err)
+	}
+	lines := strings.Split(out, "\n")
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("unknown response from git rev-parse [%s]", out)
+	}
+	s.Root = filepath.FromSlash(lines[0])
+	s.Shallow, err = strconv.ParseBool(lines[1])
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect a shallow repository %w", err)
+	}
+
+	// HEAD has no commit before the first commit and no branch when detached
+	s.Head, _ = output(ctx, directory, "rev-parse", "-q", "--verify", "--short", "HEAD")
+	if stopped := contextError(ctx, []string{"rev-parse"}); stopped != nil {
+		return nil, stopped
+	}
+	s.Branch, err = output(ctx, directory, "symbolic-ref", "-q", "--short", "HEAD")
+	if err != nil {
+		if stopped := contextError(ctx, []string{"symbolic-ref"}); stopped != nil {
+			return nil, stopped
+		}
+		s.Branch = "HEAD"
+	}
+
+	out, err = output(ctx, directory, "for-each-ref", "--format=%(refname) %(objectname:short) %(*objectname:short)", "refs/tags")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list git tags %w", err)
+	}
+	s.Tags = []TagRef{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		// annotated tags are peeled to their commit
+		tag := TagRef{Name: strings.TrimPrefix(fields[0], "refs/tags/"), Commit: fields[len(fields)-1]}
+		s.Tags = append(s.Tags, tag)
+	}
+	return s, nil
+}
+
+// contains reports whether the directory belongs to the snapshot repository
+func (s *Snapshot) contains(directory string) bool {
+	abs, err := filepath.Abs(directory)
+	if err != nil {
+		return false
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	}
+	rel, err := filepath.Rel(s.Root, abs)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// cached returns the result of run for the key, run is called by the first
+// caller while concurrent callers wait for its result without holding the
+// lock. Results of commands stopped by ctx are not cached.
+func (s *Snapshot) cached(ctx context.Context, key string, run func() (interface{}, error)) (interface{}, error) {
+	for {
+		s.mu.Lock()
+		entry, ok := s.results[key]
+		if !ok {
+			entry = &result{done: make(chan struct{})}
+			s.results[key] = entry
+		}
+		s.mu.Unlock()
+
+		if !ok {
+			entry.value, entry.err = run()
+			if ctx.Err() != nil {
+				entry.stopped = true
+				s.mu.Lock()
+				delete(s.results, key)
+				s.mu.Unlock()
+			}
+			close(entry.done)
+			return entry.value, entry.err
+		}
+
+		select {
+		case <-entry.done:
+		case <-ctx.Done():
+			return nil, contextError(ctx, []string{strings.Fields(key)[0]})
+		}
+		// the caller running the command was stopped, run it again
+		if !entry.stopped {
+			return entry.value, entry.err
+		}
+	}
+}
+
+// describe returns the cached git describe result for the key, run computes
+// it on the first call
+func (s *Snapshot) describe(ctx context.Context, key string, run func() (string, error)) (string, error) {
+	value, err := s.cached(ctx, "describe "+key, func() (interface{}, error) {
+		return run()
+	})
+	out, _ := value.(string)
+	return out, err
+}
+
+// mergedInto returns the names of the tags reachable from ref
+func (s *Snapshot) mergedInto(ctx context.Context, directory string, ref string) (map[string]bool, error) {
+	value, err := s.cached(ctx, "tag "+ref, func() (interface{}, error) {
+		out, err := output(ctx, directory, "tag", "--list", "--merged", ref)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list git tags %w", err)
+		}
+		names := map[string]bool{}
+		for _, name := range strings.Split(out, "\n") {
+			if name != "" {
+				names[name] = true
+			}
+		}
+		return names, nil
+	})
+	names, _ := value.(map[string]bool)
+	return names, err
+}
+
+// commitCount returns the number of commits reachable from HEAD
+func (s *Snapshot) commitCount(ctx context.Context, directory string) (int, error) {
+	value, err := s.cached(ctx, "rev-list", func() (interface{}, error) {
+		out, err := output(ctx, directory, "rev-list", "--count", "HEAD")
+		if err != nil {
+			return 0, err
+		}
+		return strconv.Atoi(out)
+	})
+	count, _ := value.(int)
+	return count, err
+}
+
+// globMatch matches the name against a glob of git tag --list where * also
+// matches slashes
+func globMatch(glob string, name string) bool {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	reg, err := regexp.Compile(b.String())
+	return err == nil && reg.MatchString(name)
+}
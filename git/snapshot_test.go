@@ -0,0 +1,119 @@
+package git
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+
+	runGit(t, dir, "tag", "-a", "chart/app/1.0.0", "-m", "app")
+	commit(t, dir, "app")
+	runGit(t, dir, "tag", "chart/web/2.1.0")
+	commit(t, dir, "web")
+	head := runGit(t, dir, "rev-parse", "--short", "HEAD")
+
+	snapshot, err := NewSnapshot(context.Background(), dir)
+	assert.Nil(err)
+	assert.Equal(head, snapshot.Head)
+	assert.Equal("master", snapshot.Branch)
+	assert.False(snapshot.Shallow)
+	assert.Equal([]TagRef{
+		{Name: "chart/app/1.0.0", Commit: runGit(t, dir, "rev-parse", "--short", "HEAD~2")},
+		{Name: "chart/web/2.1.0", Commit: runGit(t, dir, "rev-parse", "--short", "HEAD~1")},
+	}, snapshot.Tags)
+
+	var versionTests = []struct {
+		prefix   string
+		expected string
+	}{
+		{"chart/app/", "1.0.1-2+" + head},
+		{"chart/web/", "2.1.1-1+" + head},
+	}
+	for _, tt := range versionTests {
+		source, err := New(context.Background(), dir, &Options{TagPrefix: tt.prefix, Snapshot: snapshot})
+		assert.Nil(err)
+		assert.Equal(snapshot, source.state)
+
+		ver, err := source.NextVersion(context.Background(), nil)
+		assert.Nil(err)
+		if assert.NotNil(ver) {
+			assert.Equal(tt.expected, ver.String())
+		}
+	}
+	assert.Len(snapshot.results, 2)
+
+	// snapshots of other repositories are not used
+	other, err := ioutil.TempDir("", "helm-release")
+	assert.Nil(err)
+	defer os.RemoveAll(other)
+	_, err = New(context.Background(), other, &Options{Snapshot: snapshot})
+	assert.NotNil(err)
+}
+
+func TestGlobMatch(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(globMatch("chart/app/*", "chart/app/1.0.0"))
+	assert.True(globMatch("*", "chart/app/1.0.0"))
+	assert.True(globMatch("*1.4.*", "v1.4.2"))
+	assert.True(globMatch("v[0-9]*", "v1.0.0"))
+	assert.True(globMatch("1.0.?", "1.0.5"))
+	assert.False(globMatch("chart/app/*", "chart/web/1.0.0"))
+	assert.False(globMatch("v[!0-9]*", "v1.0.0"))
+	assert.False(globMatch("1.0.*", "11.0.0"))
+}
+
+func TestSnapshotCached(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Snapshot{results: map[string]*result{}}
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := s.cached(context.Background(), "describe slow", func() (interface{}, error) {
+				close(started)
+				<-release
+				return "slow", nil
+			})
+			assert.Nil(err)
+			assert.Equal("slow", value)
+		}()
+	}
+
+	// other keys are not blocked by a running command
+	<-started
+	value, err := s.cached(context.Background(), "describe fast", func() (interface{}, error) {
+		return "fast", nil
+	})
+	assert.Nil(err)
+	assert.Equal("fast", value)
+	close(release)
+	wg.Wait()
+
+	// results of stopped commands are computed again
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.cached(ctx, "describe stopped", func() (interface{}, error) {
+		return nil, ctx.Err()
+	})
+	assert.NotNil(err)
+	value, err = s.cached(context.Background(), "describe stopped", func() (interface{}, error) {
+		return "again", nil
+	})
+	assert.Nil(err)
+	assert.Equal("again", value)
+}
@@ -0,0 +1,104 @@
+package git
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/semver"
+)
+
+// describeOutput matches the TAG-COMMITS-gSHA output of git describe
+var describeOutput = regexp.MustCompile(`^(.+)-[0-9]+-g[0-9a-f]+$`)
+
+// tagFormat converts between tag names and semantic versions
+type tagFormat struct {
+	prefix  string
+	pattern *regexp.Regexp
+}
+
+func newTagFormat(prefix string, pattern string) (tagFormat, error) {
+	format := tagFormat{
+		prefix: prefix,
+	}
+	if pattern == "" {
+		return format, nil
+	}
+
+	reg, err := regexp.Compile(pattern)
+	if err != nil {
+		return format, fmt.Errorf("invalid tag pattern %s %s", pattern, err)
+	}
+
+	for _, name := range reg.SubexpNames() {
+		if name == "version" {
+			format.pattern = reg
+			return format, nil
+		}
+	}
+	return format, fmt.Errorf("tag pattern %s must contain the named group version", pattern)
+}
+
+// parse extracts the semantic version from the tag name
+func (f tagFormat) parse(name string) (*semver.Version, error) {
+	ver := name
+	switch {
+	case f.pattern != nil:
+		match := f.pattern.FindStringSubmatch(name)
+		if match == nil {
+			return nil, fmt.Errorf("does not match the tag pattern %s", f.pattern)
+		}
+		for i, group := range f.pattern.SubexpNames() {
+			if group == "version" {
+				ver = match[i]
+			}
+		}
+	case f.prefix != "":
+		if !strings.HasPrefix(name, f.prefix) {
+			return nil, fmt.Errorf("does not have the tag prefix %s", f.prefix)
+		}
+		ver = strings.TrimPrefix(name, f.prefix)
+	default:
+		ver = strings.TrimPrefix(ver, "v")
+		ver = strings.TrimPrefix(ver, "r")
+	}
+
+	return semver.NewVersion(ver)
+}
+
+// glob limits git describe and git tag to candidate tags of the format
+func (f tagFormat) glob(line *Line) string {
+	prefix := ""
+	if f.pattern == nil {
+		prefix = f.prefix
+	}
+
+	if line == nil {
+		return prefix + "*"
+	}
+	return fmt.Sprintf("%s*%d.%d.*", prefix, line.Major, line.Minor)
+}
+
+// name formats the version as a tag name, with a pattern the prefix has to
+// produce a name matching it so the tag is found again
+func (f tagFormat) name(ver *semver.Version) (string, error) {
+	name := f.prefix + ver.String()
+	if f.pattern == nil {
+		return name, nil
+	}
+
+	parsed, err := f.parse(name)
+	if err != nil || !parsed.Equal(ver) {
+		return "", fmt.Errorf("tag %s does not match the tag pattern %s, set a tag prefix creating matching tags", name, f.pattern)
+	}
+	return name, nil
+}
+
+// describedTag returns the tag name from the output of git describe
+func describedTag(s string) string {
+	match := describeOutput.FindStringSubmatch(s)
+	if match == nil {
+		return s
+	}
+	return match[1]
+}
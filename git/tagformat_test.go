@@ -0,0 +1,110 @@
+package git
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+)
+
+var parseTests = []struct {
+	prefix   string
+	pattern  string
+	tag      string
+	expected string // empty when the tag is not a release tag
+}{
+	{"", "", "v1.2.3", "1.2.3"},
+	{"", "", "r1.2.3", "1.2.3"},
+	{"", "", "release-1.2.3", ""},
+	{"chart/mychart/", "", "chart/mychart/1.2.3", "1.2.3"},
+	{"chart/mychart/", "", "chart/other/1.2.3", ""},
+	{"", `^release-(?P<version>.+)$`, "release-1.2.3", "1.2.3"},
+	{"", `^release-(?P<version>.+)$`, "1.2.3", ""},
+}
+
+func TestTagFormatParse(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tt := range parseTests {
+		format, err := newTagFormat(tt.prefix, tt.pattern)
+		assert.Nil(err)
+
+		ver, err := format.parse(tt.tag)
+		if tt.expected == "" {
+			assert.NotNil(err, tt.tag)
+			continue
+		}
+		if assert.Nil(err, tt.tag) {
+			assert.Equal(tt.expected, ver.String())
+		}
+	}
+}
+
+func TestTagFormatInvalidPattern(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newTagFormat("", `^release-(.+)$`)
+	assert.NotNil(err)
+}
+
+func TestTagFormatGlobAndName(t *testing.T) {
+	assert := assert.New(t)
+
+	format, _ := newTagFormat("chart/mychart/", "")
+	assert.Equal("chart/mychart/*", format.glob(nil))
+	assert.Equal("chart/mychart/*1.4.*", format.glob(&Line{Major: 1, Minor: 4}))
+
+	ver, _ := semver.NewVersion("1.2.3")
+	name, err := format.name(ver)
+	assert.Nil(err)
+	assert.Equal("chart/mychart/1.2.3", name)
+
+	format, _ = newTagFormat("", `^release-(?P<version>.+)$`)
+	_, err = format.name(ver)
+	assert.NotNil(err)
+
+	format, _ = newTagFormat("release-", `^release-(?P<version>.+)$`)
+	name, err = format.name(ver)
+	assert.Nil(err)
+	assert.Equal("release-1.2.3", name)
+}
+
+func TestDescribedTag(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("release-1.2.3", describedTag("release-1.2.3-4-g56a99c2"))
+	assert.Equal("release-1.2.3", describedTag("release-1.2.3"))
+}
+
+func TestTagPrefix(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newRepo(t)
+	defer os.RemoveAll(dir)
+
+	runGit(t, dir, "tag", "-a", "chart/mychart/1.2.3", "-m", "mychart")
+	commit(t, dir, "other")
+	runGit(t, dir, "tag", "-a", "chart/other/5.0.0", "-m", "other")
+	commit(t, dir, "next")
+
+	source, err := New(context.Background(), dir, &Options{TagPrefix: "chart/mychart/"})
+	assert.Nil(err)
+
+	ver, err := source.NextVersion(context.Background(), nil)
+	assert.Nil(err)
+	if assert.NotNil(ver) {
+		assert.Equal("1.2.4-2", ver.String()[:7])
+	}
+
+	name, err := source.CreateTag(context.Background(), ver)
+	assert.Nil(err)
+	assert.Equal("chart/mychart/1.2.4-2", name)
+	assert.Equal(name, runGit(t, dir, "describe", "--tags", "--exact-match"))
+
+	_, err = source.CreateTag(context.Background(), ver)
+	if assert.NotNil(err) {
+		assert.Contains(err.Error(), "already exists")
+	}
+}
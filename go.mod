@@ -1,6 +1,6 @@
 module github.com/sstarcher/helm-release
 
-go 1.12
+go 1.13
 
 require (
 	github.com/BurntSushi/toml v0.3.1 // indirect
@@ -13,12 +13,13 @@ require (
 	github.com/onsi/ginkgo v1.12.0 // indirect
 	github.com/onsi/gomega v1.9.0 // indirect
 	github.com/pelletier/go-toml v0.0.0-20180323185243-66540cf1fcd2 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/sirupsen/logrus v0.0.0-20180315010703-90150a8ed11b
 	github.com/spf13/afero v0.0.0-20180322225130-a880a37ed180 // indirect
 	github.com/spf13/cast v1.2.0 // indirect
 	github.com/spf13/cobra v0.0.2
 	github.com/spf13/jwalterweatherman v0.0.0-20180109140146-7c0cea34c8ec // indirect
-	github.com/spf13/pflag v0.0.0-20180220143236-ee5fd03fd6ac // indirect
+	github.com/spf13/pflag v0.0.0-20180220143236-ee5fd03fd6ac
 	github.com/spf13/viper v1.0.2
 	github.com/stretchr/testify v1.4.0
 	golang.org/x/crypto v0.0.0-20180322175230-88942b9c40a4 // indirect
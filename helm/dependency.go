@@ -0,0 +1,366 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+// andConstraint matches the space between the comparisons of a range such as
+// >=1.0.0 <2.0.0, Helm accepts it in place of a comma
+var andConstraint = regexp.MustCompile(`([0-9xX*])\s+([<>=!~^])`)
+
+// simpleConstraint matches a single version with an optional operator such as ~1.2.3
+var simpleConstraint = regexp.MustCompile(`^\s*(\^|~|>=|=)?\s*v?[0-9]+(\.[0-9]+){0,2}(-[0-9A-Za-z.-]+)?(\+[0-9A-Za-z.-]+)?\s*$`)
+
+// Dependency is a chart dependency from Chart.yaml or requirements.yaml
+type Dependency struct {
+	Name       string `yaml:"name"`
+	Version    string `yaml:"version"`
+	Repository string `yaml:"repository"`
+}
+
+// PropagationResult describes an umbrella chart updated by Propagate
+type PropagationResult struct {
+	// Chart is the directory of the umbrella chart
+	Chart string
+	// Dependency is the name of the updated dependency
+	Dependency string
+	// Version is the new version of the umbrella chart, empty when it is
+	// one of the Released charts
+	Version string
+}
+
+// requirementsFiles returns the file listing the dependencies and its lock,
+// requirements.yaml for Helm 2 charts and Chart.yaml otherwise
+func (c *Chart) requirementsFiles() (string, string) {
+	requirements := filepath.Join(c.path, "requirements.yaml")
+	if _, err := os.Stat(requirements); err == nil {
+		return requirements, filepath.Join(c.path, "requirements.lock")
+	}
+	return filepath.Join(c.path, "Chart.yaml"), filepath.Join(c.path, "Chart.lock")
+}
+
+func (c *Chart) readYaml(file string) (map[interface{}]interface{}, error) {
+	config := map[interface{}]interface{}{}
+	source, err := c.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(source, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s %s", file, err)
+	}
+	return config, nil
+}
+
+func (c *Chart) writeYaml(file string, config interface{}) error {
+	out, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return c.writeFile(file, out)
+}
+
+// Dependencies lists the dependencies of the chart
+func (c *Chart) Dependencies() ([]Dependency, error) {
+	file, _ := c.requirementsFiles()
+	source, err := c.readFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		Dependencies []Dependency `yaml:"dependencies"`
+	}
+	err = yaml.Unmarshal(source, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s %s", file, err)
+	}
+	return config.Dependencies, nil
+}
+
+// metadataName returns the name of the chart from Chart.yaml
+func (c *Chart) metadataName() string {
+	config, err := c.readYaml(filepath.Join(c.path, "Chart.yaml"))
+	if err == nil {
+		if name, ok := config["name"].(string); ok && name != "" {
+			return name
+		}
+	}
+	return c.Name
+}
+
+// refersTo reports whether the dependency of the chart is the other chart,
+// only file:// repositories pointing to the directory of the other chart are
+// local dependencies
+func (c *Chart) refersTo(dep Dependency, other *Chart) bool {
+	if dep.Name != other.metadataName() || !strings.HasPrefix(dep.Repository, "file://") {
+		return false
+	}
+	return samePath(filepath.Join(c.path, strings.TrimPrefix(dep.Repository, "file://")), other.path)
+}
+
+func samePath(a string, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// released reports whether the chart in dir is versioned by its own release
+func (c *Chart) released(dir string) bool {
+	for _, path := range c.options.Released {
+		if samePath(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// constraint rewrites a version constraint for the new version keeping the
+// operator of simple constraints, complex ranges are kept when they allow the
+// version and replaced by it otherwise
+func constraint(old string, ver string) string {
+	match := simpleConstraint.FindStringSubmatch(old)
+	if match != nil {
+		return match[1] + ver
+	}
+
+	parsed, err := newConstraint(old)
+	next, verErr := semver.NewVersion(ver)
+	if err == nil && verErr == nil && parsed.Check(next) {
+		return old
+	}
+	return ver
+}
+
+// newConstraint parses a version constraint of a chart dependency
+func newConstraint(c string) (*semver.Constraints, error) {
+	return semver.NewConstraint(andConstraint.ReplaceAllString(c, "$1, $2"))
+}
+
+// updateDependency sets the version constraint of every dependency on the
+// other chart and refreshes the lock file when requested
+func (c *Chart) updateDependency(other *Chart, ver *semver.Version, updateLock bool) (bool, error) {
+	file, lockFile := c.requirementsFiles()
+	config, err := c.readYaml(file)
+	if err != nil {
+		return false, err
+	}
+
+	release, err := ver.SetMetadata("")
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	deps, _ := config["dependencies"].([]interface{})
+	for _, item := range deps {
+		dep, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := dep["name"].(string)
+		repository, _ := dep["repository"].(string)
+		// a dependency without a version accepts any version
+		if dep["version"] == nil || !c.refersTo(Dependency{Name: name, Repository: repository}, other) {
+			continue
+		}
+
+		current := fmt.Sprint(dep["version"])
+		next := constraint(current, release.String())
+		if next == current {
+			continue
+		}
+		if !simpleConstraint.MatchString(current) {
+			log.WithFields(log.Fields{"chart": c.path, "dependency": name}).Warnf("replacing the range %s by %s, it does not allow the new version", current, next)
+		}
+		dep["version"] = next
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	err = c.writeYaml(file, config)
+	if err != nil {
+		return false, err
+	}
+
+	if updateLock {
+		err = c.updateLock(lockFile, deps, other, ver)
+	}
+	return true, err
+}
+
+// lockDependency mirrors the Helm dependency used for the lock digest
+type lockDependency struct {
+	Name         string        `json:"name" yaml:"name"`
+	Version      string        `json:"version,omitempty" yaml:"version"`
+	Repository   string        `json:"repository" yaml:"repository"`
+	Condition    string        `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Tags         []string      `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Enabled      bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	ImportValues []interface{} `json:"import-values,omitempty" yaml:"import-values,omitempty"`
+	Alias        string        `json:"alias,omitempty" yaml:"alias,omitempty"`
+}
+
+// updateLock pins the new version of the other chart in the lock file and
+// recomputes the digest the way Helm does
+func (c *Chart) updateLock(lockFile string, deps []interface{}, other *Chart, ver *semver.Version) error {
+	lock, err := c.readYaml(lockFile)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	locked, _ := lock["dependencies"].([]interface{})
+	for _, item := range locked {
+		dep, ok := item.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := dep["name"].(string)
+		repository, _ := dep["repository"].(string)
+		if c.refersTo(Dependency{Name: name, Repository: repository}, other) {
+			dep["version"] = ver.String()
+		}
+	}
+
+	req, err := convertDependencies(deps)
+	if err != nil {
+		return err
+	}
+	resolved, err := convertDependencies(locked)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if strings.HasSuffix(lockFile, "requirements.lock") {
+		data, err = json.Marshal(struct {
+			Dependencies []lockDependency `json:"dependencies"`
+		}{req})
+	} else {
+		data, err = json.Marshal([2][]lockDependency{req, resolved})
+	}
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	lock["digest"] = "sha256:" + hex.EncodeToString(sum[:])
+	lock["generated"] = time.Now().UTC().Format(time.RFC3339Nano)
+	return c.writeYaml(lockFile, lock)
+}
+
+// convertDependencies converts parsed yaml dependencies for hashing
+func convertDependencies(deps []interface{}) ([]lockDependency, error) {
+	out, err := yaml.Marshal(deps)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []lockDependency{}
+	err = yaml.Unmarshal(out, &result)
+	return result, err
+}
+
+type propagation struct {
+	chart   *Chart
+	version *semver.Version
+}
+
+// Propagate updates the dependency version of the chart in every umbrella
+// chart under root, bumps the patch version of each updated umbrella chart
+// and propagates the umbrella bumps to their own dependents. The charts are
+// written together, when one of them fails none of them change.
+func (c *Chart) Propagate(root string, ver *semver.Version, updateLock bool) ([]PropagationResult, error) {
+	var results []PropagationResult
+	err := c.transaction(func() error {
+		var err error
+		results, err = c.propagate(root, ver, updateLock)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (c *Chart) propagate(root string, ver *semver.Version, updateLock bool) ([]PropagationResult, error) {
+	charts, err := FindCharts(root, &c.options)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []PropagationResult{}
+	bumped := map[string]*semver.Version{}
+	queue := []propagation{{c, ver}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, umbrella := range charts {
+			if samePath(umbrella.path, current.chart.path) || samePath(umbrella.path, c.path) {
+				continue
+			}
+
+			changed, err := umbrella.updateDependency(current.chart, current.version, updateLock)
+			if err != nil {
+				return results, err
+			}
+			if !changed {
+				continue
+			}
+
+			if c.released(umbrella.path) {
+				results = append(results, PropagationResult{
+					Chart:      umbrella.path,
+					Dependency: current.chart.metadataName(),
+				})
+				continue
+			}
+
+			next, ok := bumped[umbrella.path]
+			if !ok {
+				prev, err := umbrella.current()
+				if err != nil {
+					return results, err
+				}
+				inc := prev.IncPatch()
+				next = &inc
+
+				err = umbrella.Set(next)
+				if err != nil {
+					return results, err
+				}
+				bumped[umbrella.path] = next
+				queue = append(queue, propagation{umbrella, next})
+			}
+
+			results = append(results, PropagationResult{
+				Chart:      umbrella.path,
+				Dependency: current.chart.metadataName(),
+				Version:    next.String(),
+			})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,188 @@
+package helm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeCharts creates the charts from a map of relative file names to contents
+func writeCharts(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "helm-release-charts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		err = os.MkdirAll(filepath.Dir(file), 0755)
+		if err == nil {
+			err = ioutil.WriteFile(file, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+var umbrellaCharts = map[string]string{
+	"sub/Chart.yaml": "apiVersion: v2\nname: sub\nversion: 1.0.0\n",
+	"umbrella/Chart.yaml": `apiVersion: v2
+name: umbrella
+version: 0.1.0
+dependencies:
+- name: sub
+  version: ~1.0.0
+  repository: file://../sub
+- name: redis
+  version: 10.0.0
+  repository: https://charts.example.com
+`,
+	"umbrella/Chart.lock": `dependencies:
+- name: sub
+  repository: file://../sub
+  version: 1.0.0
+- name: redis
+  repository: https://charts.example.com
+  version: 10.0.0
+digest: sha256:old
+generated: "2020-01-01T00:00:00Z"
+`,
+	"top/Chart.yaml":        "name: top\nversion: 2.0.0\n",
+	"top/requirements.yaml": "dependencies:\n- name: umbrella\n  version: 0.1.0\n  repository: file://../umbrella\n",
+	"other/Chart.yaml":      "apiVersion: v2\nname: other\nversion: 3.0.0\n",
+}
+
+func TestPropagate(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, umbrellaCharts)
+	defer os.RemoveAll(dir)
+
+	charts, err := FindCharts(dir, nil)
+	assert.Nil(err)
+	assert.Len(charts, 4)
+
+	sub, err := New(filepath.Join(dir, "sub"), nil)
+	assert.Nil(err)
+	ver, _ := semver.NewVersion("1.1.0")
+	assert.Nil(sub.Set(ver))
+
+	results, err := sub.Propagate(dir, ver, true)
+	assert.Nil(err)
+	assert.Equal([]PropagationResult{
+		{Chart: filepath.Join(dir, "umbrella"), Dependency: "sub", Version: "0.1.1"},
+		{Chart: filepath.Join(dir, "top"), Dependency: "umbrella", Version: "2.0.1"},
+	}, results)
+
+	umbrella := &Chart{path: filepath.Join(dir, "umbrella")}
+	deps, err := umbrella.Dependencies()
+	assert.Nil(err)
+	assert.Equal("~1.1.0", deps[0].Version)
+	assert.Equal("10.0.0", deps[1].Version)
+
+	lock, err := new(Chart).readYaml(filepath.Join(dir, "umbrella", "Chart.lock"))
+	assert.Nil(err)
+	assert.Equal("1.1.0", lock["dependencies"].([]interface{})[0].(map[interface{}]interface{})["version"])
+	assert.NotEqual("sha256:old", lock["digest"])
+
+	top := &Chart{path: filepath.Join(dir, "top")}
+	deps, err = top.Dependencies()
+	assert.Nil(err)
+	assert.Equal("0.1.1", deps[0].Version)
+
+	topVersion, err := top.Get(context.Background())
+	assert.Nil(err)
+	assert.Equal("2.0.1", topVersion.String())
+
+	other := &Chart{path: filepath.Join(dir, "other")}
+	otherVersion, _ := other.Get(context.Background())
+	assert.Equal("3.0.0", otherVersion.String())
+}
+
+func TestPropagateReleased(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, umbrellaCharts)
+	defer os.RemoveAll(dir)
+
+	sub, err := New(filepath.Join(dir, "sub"), &Options{Released: []string{filepath.Join(dir, "umbrella")}})
+	assert.Nil(err)
+	ver, _ := semver.NewVersion("1.1.0")
+	assert.Nil(sub.Set(ver))
+
+	results, err := sub.Propagate(dir, ver, false)
+	assert.Nil(err)
+	assert.Equal([]PropagationResult{
+		{Chart: filepath.Join(dir, "umbrella"), Dependency: "sub"},
+	}, results)
+
+	umbrella := &Chart{path: filepath.Join(dir, "umbrella")}
+	deps, err := umbrella.Dependencies()
+	assert.Nil(err)
+	assert.Equal("~1.1.0", deps[0].Version)
+	umbrellaVersion, err := umbrella.Get(context.Background())
+	assert.Nil(err)
+	assert.Equal("0.1.0", umbrellaVersion.String())
+
+	top := &Chart{path: filepath.Join(dir, "top")}
+	deps, err = top.Dependencies()
+	assert.Nil(err)
+	assert.Equal("0.1.0", deps[0].Version)
+}
+
+func TestPropagateRemoteDependency(t *testing.T) {
+	assert := assert.New(t)
+
+	files := map[string]string{}
+	for name, content := range umbrellaCharts {
+		files[name] = content
+	}
+	files["redis/Chart.yaml"] = "apiVersion: v2\nname: redis\nversion: 10.0.0\n"
+	dir := writeCharts(t, files)
+	defer os.RemoveAll(dir)
+
+	redis, err := New(filepath.Join(dir, "redis"), nil)
+	assert.Nil(err)
+	ver, _ := semver.NewVersion("11.0.0")
+	assert.Nil(redis.Set(ver))
+
+	results, err := redis.Propagate(dir, ver, true)
+	assert.Nil(err)
+	assert.Empty(results)
+
+	for _, name := range []string{"umbrella/Chart.yaml", "umbrella/Chart.lock"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		assert.Nil(err)
+		assert.Equal(umbrellaCharts[name], string(data), name)
+	}
+}
+
+var constraintTests = []struct {
+	old      string
+	expected string
+}{
+	{"1.0.0", "2.0.0"},
+	{"~1.0.0", "~2.0.0"},
+	{"^1.0", "^2.0.0"},
+	{">= 1.0.0", ">=2.0.0"},
+	{">=1.0.0 <2.0.0", "2.0.0"},
+	{">=1.0.0 <3.0.0", ">=1.0.0 <3.0.0"},
+	{"1.x", "2.0.0"},
+	{"2.x", "2.x"},
+	{"^1.0 || ^2.0", "^1.0 || ^2.0"},
+}
+
+func TestConstraint(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tt := range constraintTests {
+		assert.Equal(tt.expected, constraint(tt.old, "2.0.0"), tt.old)
+	}
+}
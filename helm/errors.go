@@ -0,0 +1,34 @@
+package helm
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrChartNotFound is returned when a directory does not contain a Chart.yaml
+	ErrChartNotFound = errors.New("chart not found")
+	// ErrPathMissing is matched by the errors of tag paths missing in a values file
+	ErrPathMissing = errors.New("path missing in values")
+)
+
+// ValuesError reports the failures of updating the image tags in the values files
+type ValuesError struct {
+	// Failures are prefixed by the values file they occurred in
+	Failures []string
+	errs     []error
+}
+
+func (e *ValuesError) Error() string {
+	return strings.Join(e.Failures, "; ")
+}
+
+// Is reports whether any of the failures matches the target
+func (e *ValuesError) Is(target error) bool {
+	for _, err := range e.errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
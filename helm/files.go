@@ -0,0 +1,262 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// FileSet stages the files written while updating charts in memory, reads
+// return the staged content so later updates build on earlier ones. It is
+// safe for concurrent use.
+type FileSet struct {
+	mu    sync.Mutex
+	files map[string]*stagedFile
+	order []string
+}
+
+type stagedFile struct {
+	before []byte
+	after  []byte
+	exists bool
+	mode   os.FileMode
+}
+
+// Edit is a change of a staged file
+type Edit struct {
+	File   string
+	Before []byte
+	After  []byte
+}
+
+// NewFileSet creates an empty FileSet
+func NewFileSet() *FileSet {
+	return &FileSet{files: map[string]*stagedFile{}}
+}
+
+// Read returns the staged content of the file or its content on disk
+func (f *FileSet) Read(file string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if staged, ok := f.files[file]; ok {
+		return staged.after, nil
+	}
+	return ioutil.ReadFile(file)
+}
+
+// Write stages the content of the file, the line endings are converted to
+// CRLF when the file used them
+func (f *FileSet) Write(file string, data []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	staged, ok := f.files[file]
+	if !ok {
+		staged = &stagedFile{mode: 0644}
+		info, err := os.Stat(file)
+		if err == nil {
+			staged.exists = true
+			staged.mode = info.Mode().Perm()
+			staged.before, err = ioutil.ReadFile(file)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		f.files[file] = staged
+		f.order = append(f.order, file)
+	}
+
+	if bytes.Contains(staged.before, []byte("\r\n")) {
+		data = bytes.Replace(bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1), []byte("\n"), []byte("\r\n"), -1)
+	}
+	staged.after = data
+	return nil
+}
+
+// Commit writes the edits, each file is written to a temporary file keeping
+// its permissions and renamed over the original. When any write fails the
+// files replaced so far are restored. The FileSet is empty afterwards.
+func (f *FileSet) Commit() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	edits := f.edits()
+
+	temps := map[string]string{}
+	defer func() {
+		for _, temp := range temps {
+			os.Remove(temp)
+		}
+	}()
+
+	for _, edit := range edits {
+		temp, err := f.writeTemp(edit.File)
+		if err != nil {
+			return fmt.Errorf("failed to write %s %s", edit.File, err)
+		}
+		temps[edit.File] = temp
+	}
+
+	replaced := []string{}
+	for _, edit := range edits {
+		target, err := realTarget(edit.File)
+		if err == nil {
+			err = os.Rename(temps[edit.File], target)
+		}
+		if err != nil {
+			return f.rollback(replaced, fmt.Errorf("failed to write %s %s", edit.File, err))
+		}
+		delete(temps, edit.File)
+		replaced = append(replaced, edit.File)
+	}
+
+	f.files = map[string]*stagedFile{}
+	f.order = nil
+	return nil
+}
+
+// writeTemp writes the staged content of the file to a temporary file next
+// to it with the permissions of the original
+func (f *FileSet) writeTemp(file string) (string, error) {
+	target, err := realTarget(file)
+	if err != nil {
+		return "", err
+	}
+
+	staged := f.files[file]
+	temp, err := ioutil.TempFile(filepath.Dir(target), "."+filepath.Base(target)+".")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = temp.Write(staged.after)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), staged.mode)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return "", err
+	}
+	return temp.Name(), nil
+}
+
+// rollback restores the original content of the replaced files
+func (f *FileSet) rollback(replaced []string, cause error) error {
+	failures := []string{}
+	for _, file := range replaced {
+		staged := f.files[file]
+		var err error
+		if staged.exists {
+			err = ioutil.WriteFile(file, staged.before, staged.mode)
+			if err == nil {
+				err = os.Chmod(file, staged.mode)
+			}
+		} else {
+			err = os.Remove(file)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s %s", file, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s, restoring the original files also failed: %s", cause, strings.Join(failures, "; "))
+	}
+	return cause
+}
+
+// realTarget resolves a symbolic link so the rename replaces the file it
+// points to rather than the link
+func realTarget(file string) (string, error) {
+	target, err := filepath.EvalSymlinks(file)
+	if os.IsNotExist(err) {
+		return file, nil
+	}
+	return target, err
+}
+
+// Edits returns the staged files whose content changed in the order they
+// were first written
+func (f *FileSet) Edits() []Edit {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.edits()
+}
+
+func (f *FileSet) edits() []Edit {
+	edits := []Edit{}
+	for _, file := range f.order {
+		staged := f.files[file]
+		if string(staged.before) != string(staged.after) {
+			edits = append(edits, Edit{File: file, Before: staged.before, After: staged.after})
+		}
+	}
+	return edits
+}
+
+// Diff returns the unified diff of the edit
+func (e Edit) Diff() (string, error) {
+	name := strings.TrimPrefix(filepath.ToSlash(e.File), "/")
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(e.Before),
+		B:        splitLines(e.After),
+		FromFile: "a/" + name,
+		ToFile:   "b/" + name,
+		Context:  3,
+	})
+}
+
+// splitLines splits the content into lines keeping their line endings
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// transaction stages the writes of fn and commits them together, when the
+// chart already has a FileSet the writes are only staged in it
+func (c *Chart) transaction(fn func() error) error {
+	if c.options.Files != nil {
+		return fn()
+	}
+
+	files := NewFileSet()
+	c.options.Files = files
+	defer func() {
+		c.options.Files = nil
+	}()
+
+	err := fn()
+	if err != nil {
+		return err
+	}
+	return files.Commit()
+}
+
+// readFile reads the file through the FileSet of the chart when there is one
+func (c *Chart) readFile(file string) ([]byte, error) {
+	if c.options.Files != nil {
+		return c.options.Files.Read(file)
+	}
+	return ioutil.ReadFile(file)
+}
+
+// writeFile stages the file in the FileSet of the chart when there is one and
+// writes it otherwise
+func (c *Chart) writeFile(file string, data []byte) error {
+	return c.transaction(func() error {
+		return c.options.Files.Write(file, data)
+	})
+}
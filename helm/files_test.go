@@ -0,0 +1,119 @@
+package helm
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSet(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, map[string]string{
+		"app/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"app/values.yaml": "image:\n  tag: 1.0.0\n",
+	})
+	defer os.RemoveAll(dir)
+
+	files := NewFileSet()
+	chart, err := New(filepath.Join(dir, "app"), &Options{Files: files})
+	assert.Nil(err)
+
+	ver, _ := semver.NewVersion("1.1.0")
+	assert.Nil(chart.UpdateChart(ver, "1.1.0", ""))
+
+	// the staged version is visible through the chart but not on disk
+	current, err := chart.Get(context.Background())
+	assert.Nil(err)
+	assert.Equal("1.1.0", current.String())
+	source, err := ioutil.ReadFile(filepath.Join(dir, "app", "Chart.yaml"))
+	assert.Nil(err)
+	assert.Equal("apiVersion: v2\nname: app\nversion: 1.0.0\n", string(source))
+
+	edits := files.Edits()
+	assert.Len(edits, 2)
+	assert.Equal(filepath.Join(dir, "app", "values.yaml"), edits[0].File)
+
+	diff, err := edits[0].Diff()
+	assert.Nil(err)
+	name := filepath.ToSlash(filepath.Join(dir, "app", "values.yaml"))[1:]
+	assert.Equal("--- a/"+name+"\n+++ b/"+name+"\n@@ -1,2 +1,2 @@\n image:\n-  tag: 1.0.0\n+  tag: 1.1.0\n", diff)
+
+	// writing the original content again is not an edit
+	assert.Nil(files.Write(filepath.Join(dir, "app", "values.yaml"), []byte("image:\n  tag: 1.0.0\n")))
+	assert.Len(files.Edits(), 1)
+}
+
+func TestFileSetCommit(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, map[string]string{
+		"crlf.yaml":  "image:\r\n  tag: 1.0.0\r\n",
+		"other.yaml": "tag: 1.0.0\n",
+	})
+	defer os.RemoveAll(dir)
+
+	crlf := filepath.Join(dir, "crlf.yaml")
+	other := filepath.Join(dir, "other.yaml")
+	created := filepath.Join(dir, "created.yaml")
+	assert.Nil(os.Chmod(crlf, 0600))
+
+	files := NewFileSet()
+	assert.Nil(files.Write(crlf, []byte("image:\n  tag: 1.1.0\n")))
+	assert.Nil(files.Write(other, []byte("tag: 1.1.0\n")))
+	assert.Nil(files.Write(created, []byte("tag: 1.1.0\n")))
+	assert.Nil(files.Commit())
+	assert.Empty(files.Edits())
+
+	source, _ := ioutil.ReadFile(crlf)
+	assert.Equal("image:\r\n  tag: 1.1.0\r\n", string(source))
+	info, err := os.Stat(crlf)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+	info, err = os.Stat(created)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0644), info.Mode().Perm())
+
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Len(entries, 3, "temporary files are removed")
+}
+
+func TestFileSetRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, map[string]string{
+		"first.yaml":  "tag: 1.0.0\n",
+		"second.yaml": "tag: 1.0.0\n",
+	})
+	defer os.RemoveAll(dir)
+
+	first := filepath.Join(dir, "first.yaml")
+	second := filepath.Join(dir, "second.yaml")
+	created := filepath.Join(dir, "created.yaml")
+
+	files := NewFileSet()
+	assert.Nil(files.Write(first, []byte("tag: 1.1.0\n")))
+	assert.Nil(files.Write(created, []byte("tag: 1.1.0\n")))
+	assert.Nil(files.Write(second, []byte("tag: 1.1.0\n")))
+
+	// a non empty directory can not be replaced by the rename
+	assert.Nil(os.Remove(second))
+	assert.Nil(os.MkdirAll(filepath.Join(second, "keep"), 0755))
+
+	err := files.Commit()
+	assert.NotNil(err)
+	assert.Contains(err.Error(), "failed to write "+second)
+
+	source, _ := ioutil.ReadFile(first)
+	assert.Equal("tag: 1.0.0\n", string(source))
+	_, err = os.Stat(created)
+	assert.True(os.IsNotExist(err))
+
+	entries, _ := ioutil.ReadDir(dir)
+	assert.Len(entries, 2, "temporary files are removed")
+}
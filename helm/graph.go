@@ -0,0 +1,258 @@
+package helm
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Graph is the dependency graph between the charts of a repository
+type Graph struct {
+	charts []*Chart
+	deps   map[*Chart][]*Chart
+	// constraints holds the version constraint of each edge
+	constraints map[*Chart]map[*Chart]string
+}
+
+// CycleError is returned when charts depend on each other in a cycle
+type CycleError struct {
+	Charts []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("chart dependencies contain a cycle %s", strings.Join(e.Charts, " -> "))
+}
+
+// NewGraph builds the dependency graph from the dependencies of the charts
+// on each other through Chart.yaml or requirements.yaml
+func NewGraph(charts []*Chart) (*Graph, error) {
+	g := &Graph{
+		charts:      charts,
+		deps:        map[*Chart][]*Chart{},
+		constraints: map[*Chart]map[*Chart]string{},
+	}
+
+	for _, chart := range charts {
+		deps, err := chart.Dependencies()
+		if err != nil {
+			return nil, err
+		}
+
+		g.constraints[chart] = map[*Chart]string{}
+		for _, dep := range deps {
+			for _, other := range charts {
+				if other != chart && chart.refersTo(dep, other) {
+					g.deps[chart] = append(g.deps[chart], other)
+					g.constraints[chart][other] = dep.Version
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+// Dependencies returns the charts of the graph the chart depends on
+func (g *Graph) Dependencies(chart *Chart) []*Chart {
+	return g.deps[chart]
+}
+
+// Order returns the charts with every chart after its dependencies, charts
+// without an ordering between them are sorted by path
+func (g *Graph) Order() ([]*Chart, error) {
+	remaining := map[*Chart]int{}
+	dependents := map[*Chart][]*Chart{}
+	for _, chart := range g.charts {
+		remaining[chart] = len(g.deps[chart])
+		for _, dep := range g.deps[chart] {
+			dependents[dep] = append(dependents[dep], chart)
+		}
+	}
+
+	ready := []*Chart{}
+	for _, chart := range g.charts {
+		if remaining[chart] == 0 {
+			ready = append(ready, chart)
+		}
+	}
+
+	order := []*Chart{}
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool {
+			return ready[i].path < ready[j].path
+		})
+		chart := ready[0]
+		ready = ready[1:]
+		order = append(order, chart)
+
+		for _, dependent := range dependents[chart] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	if len(order) != len(g.charts) {
+		return nil, g.cycle(remaining)
+	}
+	return order, nil
+}
+
+// cycle finds a cycle among the charts that could not be ordered
+func (g *Graph) cycle(remaining map[*Chart]int) error {
+	var start *Chart
+	for _, chart := range g.charts {
+		if remaining[chart] > 0 {
+			start = chart
+			break
+		}
+	}
+
+	// every unordered chart has an unordered dependency so walking them
+	// eventually revisits a chart
+	seen := map[*Chart]int{}
+	path := []*Chart{}
+	for chart := start; ; {
+		if index, ok := seen[chart]; ok {
+			names := []string{}
+			for _, item := range path[index:] {
+				names = append(names, item.metadataName())
+			}
+			names = append(names, chart.metadataName())
+			return &CycleError{Charts: names}
+		}
+		seen[chart] = len(path)
+		path = append(path, chart)
+
+		for _, dep := range g.deps[chart] {
+			if remaining[dep] > 0 {
+				chart = dep
+				break
+			}
+		}
+	}
+}
+
+// Outdated returns the names of the dependencies whose current version no
+// longer satisfies the version constraint of the chart
+func (g *Graph) Outdated(chart *Chart) ([]string, error) {
+	outdated := []string{}
+	for _, dep := range g.deps[chart] {
+		ver, err := dep.current()
+		if err != nil {
+			return nil, err
+		}
+
+		// a dependency without a version accepts any version
+		if g.constraints[chart][dep] == "" {
+			continue
+		}
+		constraint, err := newConstraint(g.constraints[chart][dep])
+		if err != nil || !constraint.Check(ver) {
+			outdated = append(outdated, dep.metadataName())
+		}
+	}
+	return outdated, nil
+}
+
+// NeedsBump reports the dependencies that changed for every chart needing a
+// bump, either because a dependency is outdated or a dependency needs a bump
+func (g *Graph) NeedsBump() (map[*Chart][]string, error) {
+	order, err := g.Order()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[*Chart][]string{}
+	for _, chart := range order {
+		changed, err := g.Outdated(chart)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dep := range g.deps[chart] {
+			if _, ok := result[dep]; ok && !contains(changed, dep.metadataName()) {
+				changed = append(changed, dep.metadataName())
+			}
+		}
+
+		if len(changed) > 0 {
+			sort.Strings(changed)
+			result[chart] = changed
+		}
+	}
+	return result, nil
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+// Affected returns in release order the charts that changed along with the
+// charts depending on them directly or transitively
+func (g *Graph) Affected(changed []*Chart) ([]*Chart, error) {
+	order, err := g.Order()
+	if err != nil {
+		return nil, err
+	}
+
+	affected := map[*Chart]bool{}
+	for _, chart := range changed {
+		affected[chart] = true
+	}
+
+	result := []*Chart{}
+	for _, chart := range order {
+		for _, dep := range g.deps[chart] {
+			if affected[dep] {
+				affected[chart] = true
+			}
+		}
+		if affected[chart] {
+			result = append(result, chart)
+		}
+	}
+	return result, nil
+}
+
+// Owner returns the chart containing the file, the innermost chart when
+// charts are nested, or nil when no chart contains it
+func Owner(charts []*Chart, file string) *Chart {
+	file = realPath(file)
+
+	var owner *Chart
+	longest := -1
+	for _, chart := range charts {
+		dir := realPath(chart.path)
+		if file != dir && !strings.HasPrefix(file, dir+string(filepath.Separator)) {
+			continue
+		}
+		if len(dir) > longest {
+			owner = chart
+			longest = len(dir)
+		}
+	}
+	return owner
+}
+
+// realPath returns the absolute path with symbolic links resolved when possible
+func realPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	// deleted files no longer exist, resolve their directory instead
+	if real, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(real, filepath.Base(abs))
+	}
+	return abs
+}
@@ -0,0 +1,127 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func chartNames(charts []*Chart) []string {
+	names := []string{}
+	for _, chart := range charts {
+		names = append(names, chart.Name)
+	}
+	return names
+}
+
+func TestGraphOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, umbrellaCharts)
+	defer os.RemoveAll(dir)
+
+	charts, err := FindCharts(dir, nil)
+	assert.Nil(err)
+	graph, err := NewGraph(charts)
+	assert.Nil(err)
+
+	order, err := graph.Order()
+	assert.Nil(err)
+	assert.Equal([]string{"other", "sub", "umbrella", "top"}, chartNames(order))
+
+	bumps, err := graph.NeedsBump()
+	assert.Nil(err)
+	assert.Empty(bumps)
+}
+
+func TestGraphNeedsBump(t *testing.T) {
+	assert := assert.New(t)
+
+	files := map[string]string{}
+	for name, content := range umbrellaCharts {
+		files[name] = content
+	}
+	files["sub/Chart.yaml"] = "apiVersion: v2\nname: sub\nversion: 1.1.0\n"
+
+	dir := writeCharts(t, files)
+	defer os.RemoveAll(dir)
+
+	charts, err := FindCharts(dir, nil)
+	assert.Nil(err)
+	graph, err := NewGraph(charts)
+	assert.Nil(err)
+
+	bumps, err := graph.NeedsBump()
+	assert.Nil(err)
+	result := map[string][]string{}
+	for chart, deps := range bumps {
+		result[chart.Name] = deps
+	}
+	assert.Equal(map[string][]string{
+		"umbrella": {"sub"},
+		"top":      {"umbrella"},
+	}, result)
+}
+
+func TestGraphOutdated(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, map[string]string{
+		"sub/Chart.yaml":      "apiVersion: v2\nname: sub\nversion: 1.1.0\n",
+		"umbrella/Chart.yaml": "apiVersion: v2\nname: umbrella\nversion: 0.1.0\ndependencies:\n- name: sub\n  repository: file://../sub\n",
+	})
+	defer os.RemoveAll(dir)
+
+	charts, err := FindCharts(dir, nil)
+	assert.Nil(err)
+	graph, err := NewGraph(charts)
+	assert.Nil(err)
+
+	bumps, err := graph.NeedsBump()
+	assert.Nil(err)
+	assert.Empty(bumps)
+}
+
+func TestGraphCycle(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, map[string]string{
+		"a/Chart.yaml": "apiVersion: v2\nname: a\nversion: 1.0.0\ndependencies:\n- name: b\n  version: 1.0.0\n  repository: file://../b\n",
+		"b/Chart.yaml": "apiVersion: v2\nname: b\nversion: 1.0.0\ndependencies:\n- name: a\n  version: 1.0.0\n  repository: file://../a\n",
+		"c/Chart.yaml": "apiVersion: v2\nname: c\nversion: 1.0.0\n",
+	})
+	defer os.RemoveAll(dir)
+
+	charts, err := FindCharts(dir, nil)
+	assert.Nil(err)
+	graph, err := NewGraph(charts)
+	assert.Nil(err)
+
+	_, err = graph.Order()
+	assert.Equal(&CycleError{Charts: []string{"a", "b", "a"}}, err)
+	assert.EqualError(err, "chart dependencies contain a cycle a -> b -> a")
+}
+
+func TestGraphAffected(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := writeCharts(t, umbrellaCharts)
+	defer os.RemoveAll(dir)
+
+	charts, err := FindCharts(dir, nil)
+	assert.Nil(err)
+	graph, err := NewGraph(charts)
+	assert.Nil(err)
+
+	sub := Owner(charts, filepath.Join(dir, "sub", "templates", "deleted.yaml"))
+	assert.NotNil(sub)
+	assert.Equal("sub", sub.Name)
+	assert.Nil(Owner(charts, filepath.Join(dir, "README.md")))
+	assert.Nil(Owner(charts, filepath.Join(dir, "subway", "values.yaml")))
+
+	affected, err := graph.Affected([]*Chart{sub})
+	assert.Nil(err)
+	assert.Equal([]string{"sub", "umbrella", "top"}, chartNames(affected))
+}
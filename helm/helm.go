@@ -1,17 +1,21 @@
 package helm
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
 	log "github.com/sirupsen/logrus"
 
 	"github.com/Masterminds/semver"
+	"github.com/sstarcher/helm-release/internal/errkind"
+	"github.com/sstarcher/helm-release/registry"
 	"github.com/sstarcher/helm-release/version"
 	"gopkg.in/yaml.v2"
 )
@@ -23,31 +27,126 @@ var DefaultTagPath = "image.tag"
 type ChartInterface interface {
 	version.Getter
 	version.Setter
-	UpdateChart(*semver.Version, string) error
+	UpdateChart(version *semver.Version, imageVersion string, appVersion string) error
+	Propagate(root string, version *semver.Version, updateLock bool) ([]PropagationResult, error)
+	Path() string
 }
 
 // Chart defines a Helm Chart
 type Chart struct {
-	Name    string
-	path    string
-	tagPath string
+	Name       string
+	path       string
+	options    Options
+	paths      []*Path
+	repository *regexp.Regexp
+}
+
+// appVersion policies
+const (
+	// AppVersionUpdate sets the appVersion only when Chart.yaml already has one
+	AppVersionUpdate = "update"
+	// AppVersionCreate sets the appVersion and creates it when missing
+	AppVersionCreate = "create"
+	// AppVersionKeep leaves the appVersion alone
+	AppVersionKeep = "keep"
+)
+
+// Options configures how the chart and the image tag in the values files are updated
+type Options struct {
+	// AppVersionPolicy is one of AppVersionUpdate (default), AppVersionCreate or AppVersionKeep
+	AppVersionPolicy string
+	// ValuesFiles are globs relative to the chart of the values files to update,
+	// by default values.yaml
+	ValuesFiles []string
+	// TagPaths are paths to image tags using the syntax described on Path
+	TagPaths []string
+	// CreatePath creates missing map keys of the tag paths
+	CreatePath bool
+	// StrictPath fails the update when a tag path can not be updated instead of logging a warning
+	StrictPath bool
+	// DiscoverImages updates the tag of every image map with repository and tag keys
+	DiscoverImages bool
+	// ImageRepository is a regular expression limiting the discovered images by repository
+	ImageRepository string
+	// Digest pins images to their manifest digest, DigestKey writes the digest
+	// next to the tag and DigestTag appends it to the tag
+	Digest string
+	// Image is the image used to resolve digests, by default the repository
+	// and registry keys next to the tag are used
+	Image string
+	// Resolver resolves manifest digests, by default from the image registry
+	Resolver DigestResolver
+	// Files stages the written files until the caller commits them, charts
+	// sharing it see each others staged changes. Without it every update
+	// writes its files on its own.
+	Files *FileSet
+	// Released are the directories of charts versioned by their own release
+	// in the same run, Propagate updates their dependencies without bumping
+	// them
+	Released []string
 }
 
 // New finds the helm chart in the directory and returns a Chart object
-func New(dir string, tagPath *string) (ChartInterface, error) {
+func New(dir string, options *Options) (ChartInterface, error) {
 	chart := findChart(dir)
 	if chart == nil {
-		return nil, errors.New("unable to find a Chart.yaml")
+		return nil, errkind.New("unable to find a Chart.yaml", ErrChartNotFound)
 	}
 
-	chart.tagPath = DefaultTagPath
-	if tagPath != nil {
-		chart.tagPath = *tagPath
+	err := chart.configure(options)
+	if err != nil {
+		return nil, err
 	}
-
 	return chart, nil
 }
 
+// configure applies the options and their defaults to the chart
+func (c *Chart) configure(options *Options) error {
+	if options != nil {
+		c.options = *options
+	}
+	if len(c.options.ValuesFiles) == 0 {
+		c.options.ValuesFiles = []string{DefaultValuesFile}
+	}
+	if len(c.options.TagPaths) == 0 && !c.options.DiscoverImages {
+		c.options.TagPaths = []string{DefaultTagPath}
+	}
+
+	for _, tagPath := range c.options.TagPaths {
+		p, err := ParsePath(tagPath)
+		if err != nil {
+			return err
+		}
+		c.paths = append(c.paths, p)
+	}
+
+	if c.options.ImageRepository != "" {
+		reg, err := regexp.Compile(c.options.ImageRepository)
+		if err != nil {
+			return fmt.Errorf("invalid image repository %s %s", c.options.ImageRepository, err)
+		}
+		c.repository = reg
+	}
+
+	switch c.options.Digest {
+	case "", DigestKey, DigestTag:
+	default:
+		return fmt.Errorf("invalid input for digest %s expected %s or %s", c.options.Digest, DigestKey, DigestTag)
+	}
+	switch c.options.AppVersionPolicy {
+	case "":
+		c.options.AppVersionPolicy = AppVersionUpdate
+	case AppVersionUpdate, AppVersionCreate, AppVersionKeep:
+	default:
+		return fmt.Errorf("invalid input for app version policy %s expected %s, %s or %s", c.options.AppVersionPolicy, AppVersionUpdate, AppVersionCreate, AppVersionKeep)
+	}
+
+	if c.options.Resolver == nil {
+		c.options.Resolver = registry.New()
+	}
+	return nil
+}
+
 // findChart looks for all helm charts under the given path
 func findChart(dir string) (chart *Chart) {
 	_ = filepath.Walk(dir, func(file string, f os.FileInfo, err error) error {
@@ -64,121 +163,147 @@ func findChart(dir string) (chart *Chart) {
 	return chart
 }
 
-// Set updates the version of the helm chart
-func (c *Chart) Set(version *semver.Version) error {
-	return c.UpdateChart(version, "")
+// Path returns the directory of the chart
+func (c *Chart) Path() string {
+	return c.path
 }
 
-// UpdateChart updates the version of the helm chart and appVersion
-func (c *Chart) UpdateChart(version *semver.Version, imageVersion string) error {
-	var config map[interface{}]interface{}
-	source, err := ioutil.ReadFile(c.path + "/Chart.yaml")
-	if err != nil {
-		return err
-	}
-	err = yaml.Unmarshal(source, &config)
-	if err != nil {
-		return err
-	}
-
-	config["version"] = version.String()
-	if imageVersion != "" {
-		if _, ok := config["appVersion"]; ok {
-			config["appVersion"] = imageVersion
+// FindCharts finds every helm chart under the directory sorted by path
+func FindCharts(dir string, options *Options) ([]*Chart, error) {
+	charts := []*Chart{}
+	err := filepath.Walk(dir, func(file string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() && file != dir && strings.HasPrefix(f.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if f.Name() != "Chart.yaml" {
+			return nil
 		}
 
-		err = c.updateImageVersion(imageVersion)
+		chartDir := filepath.Dir(file)
+		chart := &Chart{
+			path: chartDir,
+			Name: filepath.Base(chartDir),
+		}
+		err = chart.configure(options)
 		if err != nil {
-			log.Warnf("%v", err)
+			return err
 		}
-	}
-
-	out, err := yaml.Marshal(&config)
+		charts = append(charts, chart)
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = ioutil.WriteFile(c.path+"/Chart.yaml", out, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
+	sort.Slice(charts, func(i, j int) bool {
+		return charts[i].path < charts[j].path
+	})
+	return charts, nil
+}
+
+// Set updates the version of the helm chart
+func (c *Chart) Set(version *semver.Version) error {
+	return c.UpdateChart(version, "", "")
+}
+
+// UpdateChart updates the version of the helm chart, the appVersion according
+// to the policy and the image tag in the values files. The files are written
+// together, when one of them fails none of them change.
+func (c *Chart) UpdateChart(version *semver.Version, imageVersion string, appVersion string) error {
+	return c.transaction(func() error {
+		return c.updateChart(version, imageVersion, appVersion)
+	})
 }
 
-// updateImageVersion replaces the image tag in the values.yaml
-func (c *Chart) updateImageVersion(imageVersion string) error {
-	var values interface{}
-	valuesData, err := ioutil.ReadFile(c.path + "/values.yaml")
+func (c *Chart) updateChart(version *semver.Version, imageVersion string, appVersion string) error {
+	var config map[interface{}]interface{}
+	source, err := c.readFile(c.path + "/Chart.yaml")
 	if err != nil {
 		return err
 	}
-	err = yaml.Unmarshal(valuesData, &values)
+	err = yaml.Unmarshal(source, &config)
 	if err != nil {
 		return err
 	}
 
-	obj := values
-	if obj == nil {
-		return errors.New("the values.yaml file is empty")
+	config["version"] = version.String()
+	if appVersion != "" {
+		_, exists := config["appVersion"]
+		switch c.options.AppVersionPolicy {
+		case AppVersionCreate:
+			config["appVersion"] = appVersion
+		case AppVersionUpdate:
+			if exists {
+				config["appVersion"] = appVersion
+			}
+		}
 	}
 
-	pathArray := strings.Split(c.tagPath, ".")
-	for i := 0; i < len(pathArray); i++ {
-		k := pathArray[i]
-		switch objMap := obj.(type) {
-		case map[interface{}]interface{}:
-			if i == len(pathArray)-1 {
-				if _, ok := objMap[k]; !ok {
-					return fmt.Errorf("final key in path does not exist %s for path %s", k, c.tagPath)
-				}
-				objMap[k] = imageVersion
-				break
-			}
-			obj = objMap[k]
-			if obj == nil {
-				return fmt.Errorf("unable to process %s", c.tagPath)
+	if imageVersion != "" {
+		results, err := c.updateImageVersion(imageVersion)
+		for _, result := range results {
+			if result.Updated > 0 {
+				log.WithFields(log.Fields{"chart": c.path, "file": result.File}).Infof("updated %d image tag(s)", result.Updated)
 			}
-		default:
-			return fmt.Errorf("while processing key[%s] for path[%s] expected a map, but got %T", k, c.tagPath, objMap)
 		}
-
+		if err != nil && c.options.StrictPath {
+			return err
+		} else if err != nil {
+			log.WithField("chart", c.path).Warnf("%v", err)
+		}
 	}
 
-	out, err := yaml.Marshal(&values)
+	out, err := yaml.Marshal(&config)
 	if err != nil {
 		return err
 	}
 
-	err = ioutil.WriteFile(c.path+"/values.yaml", out, 0644)
+	err = c.writeFile(c.path+"/Chart.yaml", out)
 	if err != nil {
 		return err
 	}
-
 	return nil
 }
 
 // Get version from Chart.yaml
-func (c *Chart) Get() (*semver.Version, error) {
-	var config map[interface{}]interface{}
-	source, err := ioutil.ReadFile(c.path + "/Chart.yaml")
+func (c *Chart) Get(ctx context.Context) (*semver.Version, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.current()
+}
+
+// current reads the version from Chart.yaml
+func (c *Chart) current() (*semver.Version, error) {
+	file := c.path + "/Chart.yaml"
+	source, err := c.readFile(file)
 	if err != nil {
 		return nil, err
 	}
-	err = yaml.Unmarshal(source, &config)
+	return ParseVersion(file, source)
+}
+
+// ParseVersion reads the version from the contents of a Chart.yaml
+func ParseVersion(file string, source []byte) (*semver.Version, error) {
+	var config map[interface{}]interface{}
+	err := yaml.Unmarshal(source, &config)
 	if err != nil {
 		return nil, err
 	}
 
 	if config["version"] == nil {
-		return nil, fmt.Errorf("%s/Chart.yaml is missing a version", c.path)
+		return nil, fmt.Errorf("%s is missing a version", file)
 	}
 
-	return semver.NewVersion(config["version"].(string))
+	return semver.NewVersion(fmt.Sprint(config["version"]))
 }
 
 // NextVersion from current version
-func (c *Chart) NextVersion(nextType *version.NextType) (*semver.Version, error) {
-	ver, err := c.Get()
+func (c *Chart) NextVersion(ctx context.Context, nextType *version.NextType) (*semver.Version, error) {
+	ver, err := c.Get(ctx)
 	if err != nil {
 		return nil, err
 	}
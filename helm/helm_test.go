@@ -1,13 +1,17 @@
 package helm
 
 import (
+	"context"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 
 	"github.com/Masterminds/semver"
 	"github.com/sstarcher/helm-release/git"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
 )
 
 var noTags = "../tests/notags"
@@ -63,10 +67,10 @@ func TestVersions(t *testing.T) {
 		os.Setenv("COMMITS", tt.commits)
 		os.Setenv("IS_TAGGED", strconv.FormatBool(tt.tagged))
 
-		git, err := git.New(".")
+		git, err := git.New(context.Background(), ".", nil)
 		assert.Nil(err)
 
-		actual, err := git.NextVersion(nil)
+		actual, err := git.NextVersion(context.Background(), nil)
 		assert.NotNil(actual)
 		if actual != nil {
 			assert.Equal(tt.expected, actual.String())
@@ -81,3 +85,133 @@ func TestVersions(t *testing.T) {
 		os.Unsetenv("IS_TAGGED")
 	}
 }
+
+// newChart creates a temporary chart with the given values.yaml
+func newChart(t *testing.T, values string) string {
+	dir, err := ioutil.TempDir("", "helm-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chartDir := filepath.Join(dir, "mychart")
+	err = os.Mkdir(chartDir, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("name: mychart\nversion: 0.1.0\nappVersion: 0.1.0\n"), 0644)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte(values), 0644)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// readValues reads back the values.yaml of a chart created by newChart
+func readValues(t *testing.T, dir string) map[interface{}]interface{} {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "mychart", "values.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[interface{}]interface{}{}
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+var multiImageValues = `
+app:
+  image:
+    repository: example.com/app
+    tag: old
+sidecar:
+  image:
+    repository: example.com/proxy
+    tag: old
+third:
+  image:
+    repository: docker.io/library/redis
+    tag: old
+`
+
+var imagePathTests = []struct {
+	options Options
+	app     string
+	sidecar string
+	third   string
+	failed  bool
+}{
+	{Options{TagPaths: []string{"app.image.tag"}}, "1.0.0", "old", "old", false},
+	{Options{TagPaths: []string{"app.image.tag", "sidecar.image.tag"}}, "1.0.0", "1.0.0", "old", false},
+	{Options{TagPaths: []string{"*.image.tag"}}, "1.0.0", "1.0.0", "1.0.0", false},
+	{Options{TagPaths: []string{"app.image.tag", "missing.image.tag"}}, "1.0.0", "old", "old", true},
+	{Options{DiscoverImages: true, ImageRepository: "^example.com/"}, "1.0.0", "1.0.0", "old", false},
+	{Options{DiscoverImages: true, ImageRepository: "^nothing/"}, "old", "old", "old", true},
+}
+
+func TestImagePaths(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tt := range imagePathTests {
+		dir := newChart(t, multiImageValues)
+		defer os.RemoveAll(dir)
+
+		chart, err := New(dir, &tt.options)
+		assert.Nil(err)
+
+		_, err = chart.(*Chart).updateImageVersion("1.0.0")
+		assert.Equal(tt.failed, err != nil, "%v", err)
+
+		values := readValues(t, dir)
+		tag := func(key string) interface{} {
+			return values[key].(map[interface{}]interface{})["image"].(map[interface{}]interface{})["tag"]
+		}
+		assert.Equal(tt.app, tag("app"))
+		assert.Equal(tt.sidecar, tag("sidecar"))
+		assert.Equal(tt.third, tag("third"))
+	}
+}
+
+var appVersionTests = []struct {
+	policy   string
+	chart    string
+	expected interface{}
+}{
+	{AppVersionUpdate, "name: mychart\nversion: 0.1.0\nappVersion: 0.1.0\n", "2.0.0"},
+	{AppVersionUpdate, "name: mychart\nversion: 0.1.0\n", nil},
+	{AppVersionCreate, "name: mychart\nversion: 0.1.0\n", "2.0.0"},
+	{AppVersionKeep, "name: mychart\nversion: 0.1.0\nappVersion: 0.1.0\n", "0.1.0"},
+}
+
+func TestAppVersionPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	ver, _ := semver.NewVersion("1.0.0")
+	for _, tt := range appVersionTests {
+		dir := newChart(t, "image:\n  tag: old\n")
+		defer os.RemoveAll(dir)
+		chartFile := filepath.Join(dir, "mychart", "Chart.yaml")
+		assert.Nil(ioutil.WriteFile(chartFile, []byte(tt.chart), 0644))
+
+		chart, err := New(dir, &Options{AppVersionPolicy: tt.policy})
+		assert.Nil(err)
+
+		err = chart.UpdateChart(ver, "1.0.0", "2.0.0")
+		assert.Nil(err)
+
+		data, _ := ioutil.ReadFile(chartFile)
+		config := map[string]interface{}{}
+		assert.Nil(yaml.Unmarshal(data, &config))
+		assert.Equal("1.0.0", config["version"])
+		assert.Equal(tt.expected, config["appVersion"], tt.policy)
+		assert.Equal("1.0.0", readValues(t, dir)["image"].(map[interface{}]interface{})["tag"])
+	}
+
+	dir := newChart(t, "")
+	defer os.RemoveAll(dir)
+	_, err := New(dir, &Options{AppVersionPolicy: "always"})
+	assert.NotNil(err)
+}
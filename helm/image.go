@@ -0,0 +1,87 @@
+package helm
+
+import (
+	"fmt"
+)
+
+// Digest modes
+const (
+	// DigestKey writes the digest to the digest key next to the tag
+	DigestKey = "digest"
+	// DigestTag writes the tag as tag@sha256:...
+	DigestTag = "tag"
+)
+
+// DigestResolver resolves the manifest digest of an image tag
+type DigestResolver interface {
+	Digest(image string, tag string) (string, error)
+}
+
+// findImages returns the tag of every map containing repository and tag keys
+// whose repository matches the image repository filter
+func (c *Chart) findImages(obj interface{}) []location {
+	locations := []location{}
+	switch item := obj.(type) {
+	case map[interface{}]interface{}:
+		repository, ok := item["repository"].(string)
+		if _, hasTag := item["tag"]; ok && hasTag {
+			if c.repository == nil || c.repository.MatchString(repository) {
+				locations = append(locations, location{item, "tag"})
+			}
+			return locations
+		}
+
+		for _, child := range item {
+			locations = append(locations, c.findImages(child)...)
+		}
+	case []interface{}:
+		for _, child := range item {
+			locations = append(locations, c.findImages(child)...)
+		}
+	}
+	return locations
+}
+
+// setImage writes the image version to the location and pins the digest
+// when requested, digests are cached by image and tag
+func (c *Chart) setImage(l location, imageVersion string, digests map[string]string) error {
+	if c.options.Digest == "" {
+		l.set(imageVersion)
+		return nil
+	}
+
+	parent, isMap := l.parent.(map[interface{}]interface{})
+	image := c.options.Image
+	if image == "" && isMap {
+		image, _ = parent["repository"].(string)
+		if registry, _ := parent["registry"].(string); registry != "" && image != "" {
+			image = registry + "/" + image
+		}
+	}
+	if image == "" {
+		return fmt.Errorf("unable to determine the image to resolve the digest of %v, set the image reference", l.key)
+	}
+
+	ref := image + ":" + imageVersion
+	digest, ok := digests[ref]
+	if !ok {
+		var err error
+		digest, err = c.options.Resolver.Digest(image, imageVersion)
+		if err != nil {
+			return err
+		}
+		digests[ref] = digest
+	}
+
+	switch c.options.Digest {
+	case DigestKey:
+		if !isMap {
+			return fmt.Errorf("unable to write the digest of %s next to a tag that is not within a map", ref)
+		}
+		l.set(imageVersion)
+		parent[DigestKey] = digest
+	case DigestTag:
+		l.set(imageVersion + "@" + digest)
+	}
+	return nil
+}
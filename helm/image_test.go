@@ -0,0 +1,64 @@
+package helm
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// staticResolver returns a digest for every image except unknown
+type staticResolver struct{}
+
+func (staticResolver) Digest(image string, tag string) (string, error) {
+	if image == "unknown" {
+		return "", errors.New("manifest unknown")
+	}
+	return "sha256:" + image + "-" + tag, nil
+}
+
+var digestValues = `
+image:
+  registry: example.com
+  repository: team/app
+  tag: old
+`
+
+var digestTests = []struct {
+	options Options
+	tag     string
+	digest  interface{}
+	failed  bool
+}{
+	{Options{}, "1.0.0", nil, false},
+	{Options{Digest: DigestKey}, "1.0.0", "sha256:example.com/team/app-1.0.0", false},
+	{Options{Digest: DigestTag}, "1.0.0@sha256:example.com/team/app-1.0.0", nil, false},
+	{Options{Digest: DigestTag, Image: "other/app"}, "1.0.0@sha256:other/app-1.0.0", nil, false},
+	{Options{Digest: DigestKey, Image: "unknown"}, "old", nil, true},
+}
+
+func TestDigests(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tt := range digestTests {
+		dir := newChart(t, digestValues)
+		defer os.RemoveAll(dir)
+
+		tt.options.Resolver = staticResolver{}
+		chart, err := New(dir, &tt.options)
+		assert.Nil(err)
+
+		_, err = chart.(*Chart).updateImageVersion("1.0.0")
+		assert.Equal(tt.failed, err != nil, "%v", err)
+
+		image := readValues(t, dir)["image"].(map[interface{}]interface{})
+		assert.Equal(tt.tag, image["tag"])
+		assert.Equal(tt.digest, image["digest"])
+	}
+
+	dir := newChart(t, digestValues)
+	defer os.RemoveAll(dir)
+	_, err := New(dir, &Options{Digest: "sometimes"})
+	assert.NotNil(err)
+}
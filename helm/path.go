@@ -0,0 +1,298 @@
+package helm
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type segmentKind int
+
+const (
+	keySegment segmentKind = iota
+	indexSegment
+	selectorSegment
+	wildcardSegment
+)
+
+// segment is a single step of a Path
+type segment struct {
+	kind  segmentKind
+	key   string // map key, or the field of a selector
+	value string // value of a selector
+	index int
+	raw   string
+}
+
+// Path is a location in a values file such as containers[name=web].image.tag
+//
+// The syntax supports
+//   - dotted map keys: image.tag
+//   - list indices: containers[1].image.tag
+//   - quoted keys containing dots: annotations["app.kubernetes.io/version"]
+//   - list element selection by field: containers[name=web].image.tag
+//   - wildcards matching every map key or list element: *.image.tag or containers[*].image.tag
+type Path struct {
+	raw      string
+	segments []segment
+}
+
+// PathError reports the segment of a path that could not be resolved
+type PathError struct {
+	Path    string
+	Segment string
+	Reason  string
+}
+
+// Is matches ErrPathMissing
+func (e *PathError) Is(target error) bool {
+	return target == ErrPathMissing
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("path %s failed at segment %s: %s", e.Path, e.Segment, e.Reason)
+}
+
+// location is a settable entry of a map or list within a values file
+type location struct {
+	parent interface{}
+	key    interface{}
+}
+
+func (l location) get() interface{} {
+	switch parent := l.parent.(type) {
+	case map[interface{}]interface{}:
+		return parent[l.key]
+	case []interface{}:
+		return parent[l.key.(int)]
+	}
+	return nil
+}
+
+func (l location) set(value interface{}) {
+	switch parent := l.parent.(type) {
+	case map[interface{}]interface{}:
+		parent[l.key] = value
+	case []interface{}:
+		parent[l.key.(int)] = value
+	}
+}
+
+// ParsePath parses the path syntax described on Path
+func ParsePath(raw string) (*Path, error) {
+	p := &Path{raw: raw}
+	if raw == "" {
+		return nil, fmt.Errorf("invalid path, the path is empty")
+	}
+
+	i := 0
+	for i < len(raw) {
+		switch raw[i] {
+		case '.':
+			if i == 0 || i == len(raw)-1 || raw[i+1] == '.' || raw[i+1] == '[' {
+				return nil, fmt.Errorf("invalid path %s, unexpected . at position %d", raw, i)
+			}
+			i++
+		case '[':
+			end, seg, err := parseBracket(raw, i)
+			if err != nil {
+				return nil, err
+			}
+			p.segments = append(p.segments, seg)
+			i = end
+		default:
+			end := i
+			for end < len(raw) && raw[end] != '.' && raw[end] != '[' {
+				if raw[end] == ']' {
+					return nil, fmt.Errorf("invalid path %s, unexpected ] at position %d", raw, end)
+				}
+				end++
+			}
+
+			seg := segment{kind: keySegment, key: raw[i:end], raw: raw[i:end]}
+			if seg.key == "*" {
+				seg.kind = wildcardSegment
+			}
+			p.segments = append(p.segments, seg)
+			i = end
+		}
+	}
+	return p, nil
+}
+
+// parseBracket parses a [...] segment starting at the opening bracket
+func parseBracket(raw string, start int) (int, segment, error) {
+	i := start + 1
+	if i < len(raw) && (raw[i] == '"' || raw[i] == '\'') {
+		quote := raw[i]
+		end := strings.IndexByte(raw[i+1:], quote)
+		if end == -1 {
+			return 0, segment{}, fmt.Errorf("invalid path %s, unterminated quote at position %d", raw, i)
+		}
+		end += i + 1
+		if end+1 >= len(raw) || raw[end+1] != ']' {
+			return 0, segment{}, fmt.Errorf("invalid path %s, expected ] at position %d", raw, end+1)
+		}
+		seg := segment{kind: keySegment, key: raw[i+1 : end], raw: raw[start : end+2]}
+		return end + 2, seg, nil
+	}
+
+	end := strings.IndexByte(raw[i:], ']')
+	if end == -1 {
+		return 0, segment{}, fmt.Errorf("invalid path %s, unterminated [ at position %d", raw, start)
+	}
+	end += i
+	content := raw[i:end]
+	seg := segment{raw: raw[start : end+1]}
+
+	switch {
+	case content == "*":
+		seg.kind = wildcardSegment
+	case strings.Contains(content, "="):
+		parts := strings.SplitN(content, "=", 2)
+		seg.kind = selectorSegment
+		seg.key = strings.TrimSpace(parts[0])
+		seg.value = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+		if seg.key == "" {
+			return 0, segment{}, fmt.Errorf("invalid path %s, selector %s is missing a field", raw, seg.raw)
+		}
+	default:
+		index, err := strconv.Atoi(content)
+		if err != nil || index < 0 {
+			return 0, segment{}, fmt.Errorf("invalid path %s, %s is not a list index, quoted key or selector", raw, seg.raw)
+		}
+		seg.kind = indexSegment
+		seg.index = index
+	}
+	return end + 1, seg, nil
+}
+
+// String returns the path as written
+func (p *Path) String() string {
+	return p.raw
+}
+
+// find returns every location the path resolves to within obj
+func (p *Path) find(obj interface{}) ([]location, error) {
+	return p.walk(obj, 0, false)
+}
+
+// create is like find but creates missing map keys along the path, list
+// elements and the entries below a wildcard are never created
+func (p *Path) create(obj interface{}) ([]location, error) {
+	return p.walk(obj, 0, true)
+}
+
+func (p *Path) walk(obj interface{}, i int, create bool) ([]location, error) {
+	seg := p.segments[i]
+	last := i == len(p.segments)-1
+
+	candidates := []location{}
+	switch seg.kind {
+	case keySegment:
+		objMap, ok := obj.(map[interface{}]interface{})
+		if !ok {
+			return nil, p.fail(seg, fmt.Sprintf("expected a map, but got %s", typeName(obj)))
+		}
+		if child, ok := objMap[seg.key]; !ok || (create && child == nil) {
+			if !create {
+				return nil, p.fail(seg, "key does not exist")
+			}
+			objMap[seg.key] = nil
+			if !last {
+				objMap[seg.key] = map[interface{}]interface{}{}
+			}
+		}
+		candidates = append(candidates, location{objMap, seg.key})
+	case indexSegment:
+		list, ok := obj.([]interface{})
+		if !ok {
+			return nil, p.fail(seg, fmt.Sprintf("expected a list, but got %s", typeName(obj)))
+		}
+		if seg.index >= len(list) {
+			return nil, p.fail(seg, fmt.Sprintf("index out of range for a list of %d elements", len(list)))
+		}
+		candidates = append(candidates, location{list, seg.index})
+	case selectorSegment:
+		list, ok := obj.([]interface{})
+		if !ok {
+			return nil, p.fail(seg, fmt.Sprintf("expected a list, but got %s", typeName(obj)))
+		}
+		for index, item := range list {
+			if itemMap, ok := item.(map[interface{}]interface{}); ok {
+				if field, ok := itemMap[seg.key]; ok && fmt.Sprint(field) == seg.value {
+					candidates = append(candidates, location{list, index})
+				}
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, p.fail(seg, fmt.Sprintf("no list element with %s=%s", seg.key, seg.value))
+		}
+	case wildcardSegment:
+		switch objMap := obj.(type) {
+		case map[interface{}]interface{}:
+			keys := []interface{}{}
+			for key := range objMap {
+				keys = append(keys, key)
+			}
+			sort.Slice(keys, func(a, b int) bool {
+				return fmt.Sprint(keys[a]) < fmt.Sprint(keys[b])
+			})
+			for _, key := range keys {
+				candidates = append(candidates, location{objMap, key})
+			}
+		case []interface{}:
+			for index := range objMap {
+				candidates = append(candidates, location{objMap, index})
+			}
+		default:
+			return nil, p.fail(seg, fmt.Sprintf("expected a map or list, but got %s", typeName(obj)))
+		}
+	}
+
+	if last {
+		return candidates, nil
+	}
+
+	result := []location{}
+	for _, candidate := range candidates {
+		child := candidate.get()
+		if child == nil {
+			if seg.kind == wildcardSegment {
+				continue
+			}
+			return nil, p.fail(seg, "value is empty")
+		}
+
+		found, err := p.walk(child, i+1, create && seg.kind != wildcardSegment)
+		if err != nil {
+			if seg.kind == wildcardSegment {
+				continue // a wildcard only selects the entries the rest of the path resolves in
+			}
+			return nil, err
+		}
+		result = append(result, found...)
+	}
+	return result, nil
+}
+
+func (p *Path) fail(seg segment, reason string) error {
+	return &PathError{
+		Path:    p.raw,
+		Segment: seg.raw,
+		Reason:  reason,
+	}
+}
+
+func typeName(obj interface{}) string {
+	switch obj.(type) {
+	case map[interface{}]interface{}:
+		return "a map"
+	case []interface{}:
+		return "a list"
+	case nil:
+		return "nothing"
+	}
+	return fmt.Sprintf("the %T %v", obj, obj)
+}
@@ -0,0 +1,105 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+var pathValues = `
+image:
+  tag: old
+annotations:
+  app.kubernetes.io/version: old
+containers:
+- name: init
+  image:
+    tag: old
+- name: web
+  image:
+    tag: old
+`
+
+var pathTests = []struct {
+	path     string
+	expected []string // values of the found locations, nil when an error is expected
+	err      string
+}{
+	{"image.tag", []string{"old"}, ""},
+	{"containers[1].image.tag", []string{"old"}, ""},
+	{"containers[name=web].image.tag", []string{"old"}, ""},
+	{"containers[*].image.tag", []string{"old", "old"}, ""},
+	{`annotations["app.kubernetes.io/version"]`, []string{"old"}, ""},
+	{"*.tag", []string{"old"}, ""},
+	{"containers[2].image.tag", nil, "path containers[2].image.tag failed at segment [2]: index out of range for a list of 2 elements"},
+	{"containers[name=api].image.tag", nil, "path containers[name=api].image.tag failed at segment [name=api]: no list element with name=api"},
+	{"containers.image.tag", nil, "path containers.image.tag failed at segment image: expected a map, but got a list"},
+	{"image[0]", nil, "path image[0] failed at segment [0]: expected a list, but got a map"},
+	{"image.missing", nil, "path image.missing failed at segment missing: key does not exist"},
+}
+
+func TestPathFind(t *testing.T) {
+	assert := assert.New(t)
+
+	var values interface{}
+	err := yaml.Unmarshal([]byte(pathValues), &values)
+	assert.Nil(err)
+
+	for _, tt := range pathTests {
+		p, err := ParsePath(tt.path)
+		if !assert.Nil(err, tt.path) {
+			continue
+		}
+
+		locations, err := p.find(values)
+		if tt.expected == nil {
+			if assert.NotNil(err, tt.path) {
+				assert.Equal(tt.err, err.Error())
+			}
+			continue
+		}
+
+		assert.Nil(err, tt.path)
+		found := []string{}
+		for _, l := range locations {
+			found = append(found, l.get().(string))
+		}
+		assert.Equal(tt.expected, found, tt.path)
+	}
+}
+
+func TestParsePathErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, path := range []string{"", ".image", "image.", "image..tag", `image["tag]`, "image[tag", "image[abc]", "image[=web]", "image]"} {
+		_, err := ParsePath(path)
+		assert.NotNil(err, path)
+	}
+}
+
+func TestPathCreate(t *testing.T) {
+	assert := assert.New(t)
+
+	var values interface{}
+	err := yaml.Unmarshal([]byte("app:\n  name: web\nempty:\ncontainers:\n- name: web\n"), &values)
+	assert.Nil(err)
+
+	for _, path := range []string{"app.image.tag", "empty.image.tag", "containers[name=web].image.tag"} {
+		p, _ := ParsePath(path)
+		locations, err := p.create(values)
+		if assert.Nil(err, path) && assert.Len(locations, 1, path) {
+			locations[0].set("1.0.0")
+		}
+
+		locations, err = p.find(values)
+		assert.Nil(err, path)
+		assert.Equal("1.0.0", locations[0].get(), path)
+	}
+
+	for _, path := range []string{"containers[1].image.tag", "app.name.tag", "*.other.tag"} {
+		p, _ := ParsePath(path)
+		locations, _ := p.create(values)
+		assert.Empty(locations, path)
+	}
+}
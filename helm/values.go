@@ -0,0 +1,149 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/sstarcher/helm-release/internal/errkind"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultValuesFile is the values file updated when none are configured
+var DefaultValuesFile = "values.yaml"
+
+// ValuesResult reports how a single values file was updated
+type ValuesResult struct {
+	// File is relative to the chart directory
+	File     string
+	Updated  int
+	Failures []string
+	errs     []error
+}
+
+// valuesFiles expands the values file globs relative to the chart, a glob
+// without any matches is returned as a failed result
+func (c *Chart) valuesFiles() ([]string, []ValuesResult) {
+	seen := map[string]bool{}
+	files := []string{}
+	missing := []ValuesResult{}
+	for _, pattern := range c.options.ValuesFiles {
+		matches, err := filepath.Glob(filepath.Join(c.path, pattern))
+		if err != nil {
+			missing = append(missing, ValuesResult{File: pattern, Failures: []string{err.Error()}})
+			continue
+		}
+		if len(matches) == 0 {
+			missing = append(missing, ValuesResult{File: pattern, Failures: []string{"no values files matched"}})
+			continue
+		}
+
+		sort.Strings(matches)
+		for _, match := range matches {
+			rel, err := filepath.Rel(c.path, match)
+			if err != nil {
+				rel = match
+			}
+			if !seen[rel] {
+				seen[rel] = true
+				files = append(files, rel)
+			}
+		}
+	}
+	return files, missing
+}
+
+// updateImageVersion replaces the image tags in every values file and
+// reports which files were changed and which failed
+func (c *Chart) updateImageVersion(imageVersion string) ([]ValuesResult, error) {
+	files, results := c.valuesFiles()
+	digests := map[string]string{}
+	for _, file := range files {
+		results = append(results, c.updateValuesFile(file, imageVersion, digests))
+	}
+
+	valuesErr := &ValuesError{}
+	for _, result := range results {
+		for _, failure := range result.Failures {
+			valuesErr.Failures = append(valuesErr.Failures, fmt.Sprintf("%s: %s", result.File, failure))
+		}
+		valuesErr.errs = append(valuesErr.errs, result.errs...)
+	}
+
+	if len(valuesErr.Failures) > 0 {
+		return results, valuesErr
+	}
+	return results, nil
+}
+
+// updateValuesFile replaces the image tags in a single values file
+func (c *Chart) updateValuesFile(file string, imageVersion string, digests map[string]string) ValuesResult {
+	result := ValuesResult{File: file, Failures: []string{}}
+	fail := func(err error) ValuesResult {
+		result.Failures = append(result.Failures, err.Error())
+		result.errs = append(result.errs, err)
+		return result
+	}
+
+	var values interface{}
+	valuesData, err := c.readFile(filepath.Join(c.path, file))
+	if err != nil {
+		return fail(err)
+	}
+	err = yaml.Unmarshal(valuesData, &values)
+	if err != nil {
+		return fail(err)
+	}
+
+	if values == nil {
+		return fail(errors.New("the values file is empty"))
+	}
+
+	locations := []location{}
+	for _, p := range c.paths {
+		find := p.find
+		if c.options.CreatePath {
+			find = p.create
+		}
+		found, err := find(values)
+		if err == nil && len(found) == 0 {
+			err = errkind.New(fmt.Sprintf("no keys matched the path %s", p), ErrPathMissing)
+		}
+		if err != nil {
+			fail(err)
+			continue
+		}
+		locations = append(locations, found...)
+	}
+
+	if c.options.DiscoverImages {
+		found := c.findImages(values)
+		if len(found) == 0 {
+			fail(errors.New("unable to discover any image maps with repository and tag keys"))
+		}
+		locations = append(locations, found...)
+	}
+
+	for _, l := range locations {
+		err := c.setImage(l, imageVersion, digests)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		result.Updated++
+	}
+
+	if result.Updated > 0 {
+		out, err := yaml.Marshal(&values)
+		if err != nil {
+			return fail(err)
+		}
+
+		err = c.writeFile(filepath.Join(c.path, file), out)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	return result
+}
@@ -0,0 +1,94 @@
+package helm
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/semver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValuesFiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newChart(t, "image:\n  tag: old\n")
+	defer os.RemoveAll(dir)
+
+	chartDir := filepath.Join(dir, "mychart")
+	assert.Nil(os.Mkdir(filepath.Join(chartDir, "ci"), 0755))
+	assert.Nil(ioutil.WriteFile(filepath.Join(chartDir, "values-production.yaml"), []byte("image:\n  tag: old\n"), 0644))
+	assert.Nil(ioutil.WriteFile(filepath.Join(chartDir, "ci", "a-values.yaml"), []byte("image:\n  tag: old\n"), 0644))
+	assert.Nil(ioutil.WriteFile(filepath.Join(chartDir, "ci", "b-values.yaml"), []byte("replicas: 1\n"), 0644))
+
+	chart, err := New(dir, &Options{
+		ValuesFiles: []string{"values*.yaml", "ci/*-values.yaml", "missing/*.yaml"},
+	})
+	assert.Nil(err)
+
+	results, err := chart.(*Chart).updateImageVersion("1.0.0")
+	assert.NotNil(err)
+
+	updated := map[string]int{}
+	failed := map[string]bool{}
+	for _, result := range results {
+		updated[result.File] = result.Updated
+		failed[result.File] = len(result.Failures) > 0
+	}
+	assert.Equal(map[string]int{
+		"missing/*.yaml":         0,
+		"values-production.yaml": 1,
+		"values.yaml":            1,
+		"ci/a-values.yaml":       1,
+		"ci/b-values.yaml":       0,
+	}, updated)
+	assert.True(failed["missing/*.yaml"])
+	assert.True(failed["ci/b-values.yaml"])
+	assert.False(failed["values.yaml"])
+
+	data, err := ioutil.ReadFile(filepath.Join(chartDir, "ci", "a-values.yaml"))
+	assert.Nil(err)
+	assert.Equal("image:\n  tag: 1.0.0\n", string(data))
+}
+
+func TestStrictPath(t *testing.T) {
+	assert := assert.New(t)
+
+	ver, _ := semver.NewVersion("1.0.0")
+	for _, strict := range []bool{false, true} {
+		dir := newChart(t, "replicas: 1\n")
+		defer os.RemoveAll(dir)
+
+		chart, err := New(dir, &Options{StrictPath: strict})
+		assert.Nil(err)
+
+		err = chart.UpdateChart(ver, "1.0.0", "1.0.0")
+		assert.Equal(strict, err != nil)
+		assert.Equal(strict, errors.Is(err, ErrPathMissing))
+	}
+
+	dir := newChart(t, "replicas: 1\n")
+	defer os.RemoveAll(dir)
+	_, err := New(filepath.Join(dir, "templates"), nil)
+	assert.True(errors.Is(err, ErrChartNotFound))
+}
+
+func TestCreatePath(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := newChart(t, "replicas: 1\n")
+	defer os.RemoveAll(dir)
+
+	chart, err := New(dir, &Options{CreatePath: true, StrictPath: true})
+	assert.Nil(err)
+
+	ver, _ := semver.NewVersion("1.0.0")
+	err = chart.UpdateChart(ver, "1.0.0", "1.0.0")
+	assert.Nil(err)
+
+	values := readValues(t, dir)
+	assert.Equal("1.0.0", values["image"].(map[interface{}]interface{})["tag"])
+	assert.Equal(1, values["replicas"])
+}
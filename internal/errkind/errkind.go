@@ -0,0 +1,22 @@
+// Package errkind lets errors keep their own message while matching the
+// exported error of their failure category with errors.Is
+package errkind
+
+// kindError keeps its own message while matching its kind
+type kindError struct {
+	message string
+	kind    error
+}
+
+// New returns an error with the message that matches kind
+func New(message string, kind error) error {
+	return &kindError{message, kind}
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
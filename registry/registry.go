@@ -0,0 +1,265 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultRegistry is used for images without a registry host
+const DefaultRegistry = "registry-1.docker.io"
+
+// manifestTypes are the manifest media types accepted from the registry
+var manifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+}
+
+// Client resolves manifest digests with the Docker Registry v2 API
+type Client struct {
+	HTTPClient *http.Client
+	// PlainHTTP talks to the registry over http instead of https
+	PlainHTTP bool
+	Username  string
+	Password  string
+}
+
+// New creates a registry client
+func New() *Client {
+	return &Client{
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Reference is an image split into the registry host and repository name
+type Reference struct {
+	Host       string
+	Repository string
+}
+
+// ParseReference splits an image such as example.com/app or nginx into
+// the registry host and repository
+func ParseReference(image string) (*Reference, error) {
+	if image == "" || strings.ContainsAny(image, "@ ") {
+		return nil, fmt.Errorf("invalid image reference %s", image)
+	}
+
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host := parts[0]
+		if host == "docker.io" || host == "index.docker.io" {
+			host = DefaultRegistry
+		}
+		return &Reference{Host: host, Repository: defaultNamespace(host, parts[1])}, nil
+	}
+	return &Reference{Host: DefaultRegistry, Repository: defaultNamespace(DefaultRegistry, image)}, nil
+}
+
+// defaultNamespace prefixes official Docker Hub images with library/
+func defaultNamespace(host string, repository string) string {
+	if host == DefaultRegistry && !strings.Contains(repository, "/") {
+		return "library/" + repository
+	}
+	return repository
+}
+
+// Digest resolves the manifest digest of the image tag
+func (c *Client) Digest(image string, tag string) (string, error) {
+	ref, err := ParseReference(image)
+	if err != nil {
+		return "", err
+	}
+
+	scheme := "https"
+	if c.PlainHTTP {
+		scheme = "http"
+	}
+	manifestURL := fmt.Sprintf("%s://%s/v2/%s/manifests/%s", scheme, ref.Host, ref.Repository, tag)
+
+	auth := ""
+	resp, err := c.request(http.MethodHead, manifestURL, auth)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		auth, err = c.authorize(resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", fmt.Errorf("failed to authorize with %s %s", ref.Host, err)
+		}
+		resp, err = c.request(http.MethodHead, manifestURL, auth)
+		if err != nil {
+			return "", err
+		}
+		resp.Body.Close()
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to resolve %s:%s, the registry responded with %s", image, tag, resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return c.digestFromBody(manifestURL, auth)
+	}
+	return digest, nil
+}
+
+// digestFromBody computes the digest of the manifest for registries that do
+// not return the Docker-Content-Digest header
+func (c *Client) digestFromBody(manifestURL string, auth string) (string, error) {
+	resp, err := c.request(http.MethodGet, manifestURL, auth)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to fetch the manifest %s, the registry responded with %s", manifestURL, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func (c *Client) request(method string, target string, auth string) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return c.httpClient().Do(req)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// authorize answers a Basic or Bearer challenge and returns the Authorization header
+func (c *Client) authorize(challenge string) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if c.Username == "" {
+			return "", fmt.Errorf("the registry requires credentials")
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(c.Username, c.Password)
+		return req.Header.Get("Authorization"), nil
+	case "bearer":
+		return c.token(params)
+	}
+	return "", fmt.Errorf("unsupported authentication challenge %s", challenge)
+}
+
+// token fetches a bearer token from the realm of the challenge
+func (c *Client) token(params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid token realm %s", params["realm"])
+	}
+
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.Username != "" {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request responded with %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		return "", err
+	}
+
+	token := body.Token
+	if token == "" {
+		token = body.AccessToken
+	}
+	if token == "" {
+		return "", fmt.Errorf("token response did not contain a token")
+	}
+	return "Bearer " + token, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header such as
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme := strings.ToLower(parts[0])
+	if len(parts) < 2 {
+		return scheme, params
+	}
+
+	rest := parts[1]
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = strings.TrimSpace(rest[eq+1:])
+
+		value := ""
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end == -1 {
+				value, rest = rest, ""
+			} else {
+				value, rest = rest[:end], rest[end:]
+			}
+		}
+		params[key] = value
+		rest = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return scheme, params
+}
@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var referenceTests = []struct {
+	image      string
+	host       string
+	repository string
+}{
+	{"nginx", DefaultRegistry, "library/nginx"},
+	{"bitnami/redis", DefaultRegistry, "bitnami/redis"},
+	{"docker.io/nginx", DefaultRegistry, "library/nginx"},
+	{"example.com/team/app", "example.com", "team/app"},
+	{"localhost:5000/app", "localhost:5000", "app"},
+}
+
+func TestParseReference(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, tt := range referenceTests {
+		ref, err := ParseReference(tt.image)
+		assert.Nil(err)
+		assert.Equal(tt.host, ref.Host, tt.image)
+		assert.Equal(tt.repository, ref.Repository, tt.image)
+	}
+
+	_, err := ParseReference("app@sha256:abc")
+	assert.NotNil(err)
+}
+
+// newRegistry serves a single manifest behind bearer token authentication
+func newRegistry(withHeader bool) (*httptest.Server, string) {
+	manifest := `{"schemaVersion":2}`
+	sum := sha256.Sum256([]byte(manifest))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("scope") != "repository:team/app:pull" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"token":"secret"}`)
+	})
+	mux.HandleFunc("/v2/team/app/manifests/1.0.0", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:team/app:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if withHeader {
+			w.Header().Set("Docker-Content-Digest", digest)
+		}
+		if r.Method == http.MethodGet {
+			fmt.Fprint(w, manifest)
+		}
+	})
+	return server, digest
+}
+
+func TestDigest(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, withHeader := range []bool{true, false} {
+		server, expected := newRegistry(withHeader)
+		defer server.Close()
+
+		client := New()
+		client.PlainHTTP = true
+		image := strings.TrimPrefix(server.URL, "http://") + "/team/app"
+
+		digest, err := client.Digest(image, "1.0.0")
+		assert.Nil(err)
+		assert.Equal(expected, digest)
+
+		_, err = client.Digest(image, "2.0.0")
+		assert.NotNil(err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	assert := assert.New(t)
+
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/nginx:pull"`)
+	assert.Equal("bearer", scheme)
+	assert.Equal("https://auth.docker.io/token", params["realm"])
+	assert.Equal("registry.docker.io", params["service"])
+	assert.Equal("repository:library/nginx:pull", params["scope"])
+}
@@ -0,0 +1,67 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/sstarcher/helm-release/git"
+)
+
+// AppVersionImageTag is the appVersion source reusing the image tag
+const AppVersionImageTag = "image-tag"
+
+// resolveAppVersion determines the appVersion from its source independently
+// of the chart version, image-tag reuses the image tag
+func resolveAppVersion(ctx context.Context, dir string, source string, imageTag string, repo *git.Options) (string, error) {
+	switch {
+	case source == "" || source == AppVersionImageTag:
+		return imageTag, nil
+	case strings.HasPrefix(source, "git:"):
+		prefix := strings.TrimSuffix(strings.TrimPrefix(source, "git:"), "*")
+		getter, err := git.New(ctx, dir, &git.Options{TagPrefix: prefix, Env: repo.Env, Snapshot: repo.Snapshot})
+		if err != nil {
+			return "", err
+		}
+		ver, err := getter.Latest(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to determine the app version from the %s tags %w", prefix, err)
+		}
+		return ver.String(), nil
+	case strings.HasPrefix(source, "file:"):
+		return appVersionFromFile(strings.TrimPrefix(source, "file:"))
+	}
+	return "", fmt.Errorf("invalid input for app-version-source %s", source)
+}
+
+// appVersionFromFile reads a plain VERSION file or the version field of a
+// json file such as package.json
+func appVersionFromFile(file string) (string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	if filepath.Ext(file) != ".json" {
+		ver := strings.TrimSpace(string(data))
+		if ver == "" {
+			return "", fmt.Errorf("%s is empty", file)
+		}
+		return ver, nil
+	}
+
+	var pkg struct {
+		Version string `json:"version"`
+	}
+	err = json.Unmarshal(data, &pkg)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s %s", file, err)
+	}
+	if pkg.Version == "" {
+		return "", fmt.Errorf("%s is missing a version", file)
+	}
+	return pkg.Version, nil
+}
@@ -0,0 +1,260 @@
+// Package release computes the next version of a chart and applies it to the
+// chart files, it is the library behind the helm-release command
+package release
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/semver"
+	log "github.com/sirupsen/logrus"
+	"github.com/sstarcher/helm-release/git"
+	"github.com/sstarcher/helm-release/helm"
+	"github.com/sstarcher/helm-release/version"
+)
+
+// version sources
+const (
+	// SourceGit computes versions from the git history
+	SourceGit = "git"
+	// SourceHelm bumps the version in Chart.yaml
+	SourceHelm = "helm"
+)
+
+// Options configures a release
+type Options struct {
+	// Source of the version, SourceGit (default) or SourceHelm
+	Source string
+	// Bump is major, minor or patch, it is required by SourceHelm
+	Bump string
+	// Strict fails when the tags in the history are out of sync with the next version
+	Strict bool
+	// Git configures the git source, {chart} in its TagPrefix is replaced by
+	// the chart directory name. Without Env no environment variables are read.
+	// Releases of several charts of a repository share a Snapshot of it.
+	Git git.Options
+	// Helm configures how the chart files are updated, the edits are staged
+	// in its Files when set
+	Helm helm.Options
+	// ImageTag is the image tag, by default the version without metadata
+	ImageTag string
+	// SkipImageTag leaves the image tags and the appVersion alone
+	SkipImageTag bool
+	// AppVersionSource is AppVersionImageTag (default), git:TAG_PREFIX or
+	// file:PATH where a .json file provides its version field
+	AppVersionSource string
+	// Propagate updates the charts depending on the chart under PropagateRoot
+	Propagate bool
+	// PropagateRoot is the directory searched for umbrella charts
+	PropagateRoot string
+	// UpdateLock refreshes the lock files of the umbrella charts
+	UpdateLock bool
+	// CreateTag creates an annotated git tag for the version on Apply
+	CreateTag bool
+}
+
+// Plan describes the changes of a release, nothing is written until Apply
+type Plan struct {
+	// Chart is the directory of the chart
+	Chart string
+	// Version is the next version of the chart
+	Version *semver.Version
+	// ImageTag is the image tag set in the values files
+	ImageTag string
+	// AppVersion is the appVersion set in Chart.yaml
+	AppVersion string
+	// Propagated lists the umbrella charts updated for the version
+	Propagated []helm.PropagationResult
+	// Edits are the staged file changes
+	Edits []helm.Edit
+	// Tag is the name of the git tag created by Apply when requested
+	Tag string
+
+	files   *helm.FileSet
+	options Options
+}
+
+// noEnv is the environment of the git source when none is configured
+func noEnv(key string) (string, bool) {
+	return "", false
+}
+
+// gitOptions returns the git options for the chart in dir
+func (o *Options) gitOptions(dir string) *git.Options {
+	options := o.Git
+	if options.Env == nil {
+		options.Env = noEnv
+	}
+
+	name := dir
+	if abs, err := filepath.Abs(dir); err == nil {
+		name = abs
+	}
+	options.TagPrefix = strings.Replace(options.TagPrefix, "{chart}", filepath.Base(name), -1)
+	return &options
+}
+
+// getterSource returns the name of the source with the default applied
+func getterSource(source string) string {
+	if source == "" {
+		return SourceGit
+	}
+	return source
+}
+
+// Getter returns the version source of the chart in dir
+func Getter(ctx context.Context, dir string, options *Options) (version.Getter, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	switch options.Source {
+	case "", SourceGit:
+		repo, err := git.New(ctx, dir, options.gitOptions(dir))
+		if err != nil {
+			return nil, err
+		}
+		return repo, nil
+	case SourceHelm:
+		return helm.New(dir, &helm.Options{Files: options.Helm.Files})
+	}
+	return nil, fmt.Errorf("invalid input for source %s", options.Source)
+}
+
+// NextVersion computes the next version of the chart in dir, in strict mode
+// tags out of sync with it fail with a *git.OutOfSyncError. The git commands
+// are stopped once ctx is done.
+func NextVersion(ctx context.Context, dir string, options *Options) (*semver.Version, error) {
+	if options == nil {
+		options = &Options{}
+	}
+	if options.Source == SourceHelm && options.Bump == "" {
+		return nil, fmt.Errorf("a bump must be specified when using a helm source")
+	}
+
+	getter, err := Getter(ctx, dir, options)
+	if err != nil {
+		return nil, err
+	}
+
+	ver, err := getter.NextVersion(ctx, version.NewNextType(options.Bump))
+	if ver == nil {
+		if err == nil {
+			err = fmt.Errorf("unable to compute the next version of %s", dir)
+		}
+		return nil, err
+	}
+	if err != nil && options.Strict {
+		return nil, err
+	}
+	return ver, nil
+}
+
+// Compute plans the release of the chart in dir, the chart files are only
+// staged and written by Apply
+func Compute(ctx context.Context, dir string, options *Options) (*Plan, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	ver, err := NextVersion(ctx, dir, options)
+	if err != nil {
+		return nil, err
+	}
+	return Stage(ctx, dir, ver, options)
+}
+
+// Stage plans the release of the chart in dir at a version computed by
+// NextVersion, it lets the versions of several charts be computed
+// concurrently while their files are staged one chart at a time
+func Stage(ctx context.Context, dir string, ver *semver.Version, options *Options) (*Plan, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	plan := &Plan{
+		Version: ver,
+		files:   options.Helm.Files,
+		options: *options,
+	}
+	if plan.files == nil {
+		plan.files = helm.NewFileSet()
+	}
+
+	helmOptions := options.Helm
+	helmOptions.Files = plan.files
+	chart, err := helm.New(dir, &helmOptions)
+	if err != nil {
+		return nil, err
+	}
+	plan.Chart = chart.Path()
+
+	if options.CreateTag {
+		repo, err := git.New(ctx, dir, options.gitOptions(dir))
+		if err != nil {
+			return nil, err
+		}
+		plan.Tag, err = repo.TagName(ver)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !options.SkipImageTag {
+		plan.ImageTag = options.ImageTag
+		if plan.ImageTag == "" {
+			release, _ := ver.SetMetadata("")
+			plan.ImageTag = release.String()
+		}
+
+		plan.AppVersion, err = resolveAppVersion(ctx, dir, options.AppVersionSource, plan.ImageTag, options.gitOptions(dir))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"chart":   plan.Chart,
+		"source":  getterSource(options.Source),
+		"version": ver.String(),
+	}).Info("updating the Chart.yaml")
+	err = chart.UpdateChart(ver, plan.ImageTag, plan.AppVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.Propagate {
+		root := options.PropagateRoot
+		if root == "" {
+			root = "."
+		}
+		plan.Propagated, err = chart.Propagate(root, ver, options.UpdateLock)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plan.Edits = plan.files.Edits()
+	return plan, nil
+}
+
+// Apply writes the edits of the plan and creates the git tag when requested
+func (p *Plan) Apply(ctx context.Context) error {
+	err := p.files.Commit()
+	if err != nil {
+		return err
+	}
+
+	if !p.options.CreateTag {
+		return nil
+	}
+
+	repo, err := git.New(ctx, p.Chart, p.options.gitOptions(p.Chart))
+	if err != nil {
+		return err
+	}
+	_, err = repo.CreateTag(ctx, p.Version)
+	return err
+}
@@ -0,0 +1,126 @@
+package release
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/sstarcher/helm-release/git"
+	"github.com/sstarcher/helm-release/helm"
+	"github.com/stretchr/testify/assert"
+)
+
+// newChart creates a git repository containing a chart
+func newChart(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "helm-release")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chart := filepath.Join(dir, "app")
+	err = os.MkdirAll(chart, 0755)
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(chart, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 1.0.0\nappVersion: 1.0.0\n"), 0644)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(chart, "values.yaml"), []byte("image:\n  tag: 1.0.0\n"), 0644)
+	}
+	if err == nil {
+		cmd := exec.Command("git", "init", "-q")
+		cmd.Dir = dir
+		err = cmd.Run()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chart
+}
+
+func readFile(t *testing.T, file string) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestPlan(t *testing.T) {
+	assert := assert.New(t)
+
+	chart := newChart(t)
+	defer os.RemoveAll(filepath.Dir(chart))
+
+	plan, err := Compute(context.Background(), chart, &Options{Source: SourceHelm, Bump: "minor"})
+	assert.Nil(err)
+	assert.Equal(chart, plan.Chart)
+	assert.Equal("1.1.0", plan.Version.String())
+	assert.Equal("1.1.0", plan.ImageTag)
+	assert.Equal("1.1.0", plan.AppVersion)
+	assert.Len(plan.Edits, 2)
+
+	// nothing is written before Apply
+	assert.Equal("image:\n  tag: 1.0.0\n", readFile(t, filepath.Join(chart, "values.yaml")))
+
+	assert.Nil(plan.Apply(context.Background()))
+	assert.Equal("image:\n  tag: 1.1.0\n", readFile(t, filepath.Join(chart, "values.yaml")))
+	assert.Contains(readFile(t, filepath.Join(chart, "Chart.yaml")), "version: 1.1.0")
+}
+
+func TestOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	chart := newChart(t)
+	defer os.RemoveAll(filepath.Dir(chart))
+
+	_, err := NextVersion(context.Background(), chart, &Options{Source: SourceHelm})
+	assert.EqualError(err, "a bump must be specified when using a helm source")
+
+	_, err = Getter(context.Background(), chart, &Options{Source: "svn"})
+	assert.EqualError(err, "invalid input for source svn")
+
+	env := map[string]string{
+		"LAST_TAG":    "1.2.3",
+		"IS_TAGGED":   "false",
+		"COMMITS":     "4",
+		"SHA":         "abc1234",
+		"BRANCH_NAME": "master",
+	}
+	ver, err := NextVersion(context.Background(), chart, &Options{Git: git.Options{Env: func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}}})
+	assert.Nil(err)
+	assert.Equal("1.2.4-4+abc1234", ver.String())
+
+	files := helm.NewFileSet()
+	plan, err := Compute(context.Background(), chart, &Options{Source: SourceHelm, Bump: "patch", SkipImageTag: true, Helm: helm.Options{Files: files}})
+	assert.Nil(err)
+	assert.Equal("", plan.ImageTag)
+	assert.Equal(files.Edits(), plan.Edits)
+	assert.Len(plan.Edits, 1)
+}
+
+func TestStage(t *testing.T) {
+	assert := assert.New(t)
+
+	chart := newChart(t)
+	defer os.RemoveAll(filepath.Dir(chart))
+
+	options := &Options{Source: SourceHelm, Bump: "patch", Helm: helm.Options{Files: helm.NewFileSet()}}
+	ver, err := NextVersion(context.Background(), chart, options)
+	assert.Nil(err)
+
+	plan, err := Stage(context.Background(), chart, ver, options)
+	assert.Nil(err)
+	assert.Equal("1.0.1", plan.Version.String())
+	assert.Equal("1.0.1", plan.ImageTag)
+	assert.Len(plan.Edits, 2)
+
+	// the staged Chart.yaml is the base of the next version
+	ver, err = NextVersion(context.Background(), chart, options)
+	assert.Nil(err)
+	assert.Equal("1.0.2", ver.String())
+}
@@ -1,6 +1,7 @@
 package version
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -29,10 +30,10 @@ func NewNextType(val string) *NextType {
 	return nil
 }
 
-// Getter for versions
+// Getter for versions, ctx bounds any external commands run to find them
 type Getter interface {
-	Get() (*semver.Version, error)
-	NextVersion(nextType *NextType) (*semver.Version, error)
+	Get(ctx context.Context) (*semver.Version, error)
+	NextVersion(ctx context.Context, nextType *NextType) (*semver.Version, error)
 }
 
 // Setter for versions